@@ -0,0 +1,211 @@
+/*
+ * Copyright (c) 2017, 2020 ADLINK Technology Inc.
+ *
+ * This program and the accompanying materials are made available under the
+ * terms of the Eclipse Public License 2.0 which is available at
+ * http://www.eclipse.org/legal/epl-2.0, or the Apache License, Version 2.0
+ * which is available at https://www.apache.org/licenses/LICENSE-2.0.
+ *
+ * SPDX-License-Identifier: EPL-2.0 OR Apache-2.0
+ *
+ * Contributors:
+ *   ADLINK zenoh team, <zenoh@adlink-labs.tech>
+ */
+
+package zenoh
+
+import (
+	"strings"
+	"sync"
+	"time"
+)
+
+// Cache is a local copy of a selection of path/value, kept up to date
+// via a subscription (see Workspace.Cache()).
+type Cache struct {
+	w        *Workspace
+	selector *Selector
+	filter   *Predicate
+	subid    *SubscriptionID
+
+	mu         *sync.RWMutex
+	entries    map[Path]Data
+	hooks      []Listener
+	lastUpdate time.Time
+	closed     bool
+}
+
+// Cache creates a Cache for a selection of path/value.
+//
+// The Cache is initialized with the current values of the selection (as returned by Get()),
+// and then applies the PUT, UPDATE and REMOVE changes received for the selection.
+// The UPDATE changes with a JSON value are applied as JSON merge patches (see ApplyMergePatch()).
+// If the selector has a predicate part, the paths which value no longer satisfies it are removed.
+// It must be closed when no longer used.
+func (w *Workspace) Cache(selector *Selector) (*Cache, error) {
+	s := w.toAbsoluteSelector(selector)
+	logger.WithField("selector", s).Debug("Cache")
+
+	filter, err := s.Filter()
+	if err != nil {
+		return nil, &ZError{Msg: "Cache on " + s.ToString() + " failed", Code: 0, Cause: err}
+	}
+	c := &Cache{w: w, selector: s, filter: filter, mu: new(sync.RWMutex), entries: make(map[Path]Data)}
+	// the changes are applied by the I/O subroutine, the hooks being called via the executor (if any)
+	initDone := make(chan struct{})
+	opts := &SubscribeOptions{InitialState: true, initDone: initDone, removeFiltered: true, onClose: c.markClosed}
+	subid, err := w.subscribe(s, w.interceptListener(s, c.apply), opts, nil)
+	if err != nil {
+		return nil, &ZError{Msg: "Cache on " + s.ToString() + " failed", Code: 0, Cause: err}
+	}
+	c.subid = subid
+	// the initial state is applied by another subroutine
+	<-initDone
+	c.mu.Lock()
+	c.lastUpdate = time.Now()
+	c.mu.Unlock()
+	return c, nil
+}
+
+// Selector returns the (absolute) Selector of the Cache
+func (c *Cache) Selector() *Selector {
+	return c.selector
+}
+
+// Get returns the cached Data for the Path p, or nil if there is none.
+// If p is relative, it's relative to the Workspace's path.
+func (c *Cache) Get(p *Path) *Data {
+	p = c.w.toAbsolutePath(p)
+	c.mu.RLock()
+	defer c.mu.RUnlock()
+	d, ok := c.entries[*p]
+	if !ok {
+		return nil
+	}
+	return &d
+}
+
+// List returns the cached Data for the Path prefix and all the Paths under it.
+// If prefix is relative, it's relative to the Workspace's path.
+func (c *Cache) List(prefix *Path) []Data {
+	prefix = c.w.toAbsolutePath(prefix)
+	c.mu.RLock()
+	defer c.mu.RUnlock()
+	result := make([]Data, 0)
+	for p, d := range c.entries {
+		if p.path == prefix.path || strings.HasPrefix(p.path, prefix.path+"/") {
+			result = append(result, d)
+		}
+	}
+	return result
+}
+
+// Snapshot returns all the cached Data.
+func (c *Cache) Snapshot() []Data {
+	c.mu.RLock()
+	defer c.mu.RUnlock()
+	result := make([]Data, 0, len(c.entries))
+	for _, d := range c.entries {
+		result = append(result, d)
+	}
+	return result
+}
+
+// OnChange registers a listener that will be called for each change applied to the Cache.
+// The listener receives the changes as applied: an UPDATE change is notified as a PUT change
+// with the merged value, and a change removing a Path from the Cache (e.g. because its value
+// no longer satisfies the predicate) as a REMOVE change.
+//
+// As for Workspace.Subscribe(), the listener is executed by the I/O subroutine,
+// or by the executor of the Workspace if it has one.
+func (c *Cache) OnChange(listener Listener) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.hooks = append(c.hooks, listener)
+}
+
+// LastUpdate returns the time at which the last change has been applied to the Cache
+// (or at which it has been initialized, if no change has been applied since).
+func (c *Cache) LastUpdate() time.Time {
+	c.mu.RLock()
+	defer c.mu.RUnlock()
+	return c.lastUpdate
+}
+
+// IsStale returns true if the Cache is closed, or if no change has been applied
+// to the Cache during the maxAge duration.
+// A maxAge of 0 only checks if the Cache is closed.
+func (c *Cache) IsStale(maxAge time.Duration) bool {
+	c.mu.RLock()
+	defer c.mu.RUnlock()
+	return c.closed || (maxAge > 0 && time.Since(c.lastUpdate) > maxAge)
+}
+
+// Close unsubscribes the Cache. The cached Data remain available, but are no longer updated.
+// It does nothing if the Cache has already been closed (e.g. by Workspace.Close()).
+func (c *Cache) Close() error {
+	c.mu.Lock()
+	if c.closed {
+		c.mu.Unlock()
+		return nil
+	}
+	c.closed = true
+	c.mu.Unlock()
+	return c.w.Unsubscribe(c.subid)
+}
+
+// markClosed marks the Cache as closed, once unsubscribed.
+func (c *Cache) markClosed() {
+	c.mu.Lock()
+	c.closed = true
+	c.mu.Unlock()
+}
+
+// apply applies the changes to the Cache and calls the hooks with the applied changes.
+func (c *Cache) apply(changes []Change) {
+	applied := make([]Change, 0, len(changes))
+	c.mu.Lock()
+	for _, change := range changes {
+		switch change.kind {
+		case REMOVE:
+			delete(c.entries, *change.path)
+			applied = append(applied, change)
+		case UPDATE:
+			var last Value
+			if d, ok := c.entries[*change.path]; ok {
+				last = d.value
+			}
+			d := Data{path: change.path, value: change.value, tstamp: change.timestamp, err: change.err}
+			if merged, err := mergeUpdate(last, change.value); err != nil {
+				d.err = err
+			} else {
+				d.value = merged
+			}
+			if d.err == nil && d.value != nil && !c.filter.Match(d.value) {
+				delete(c.entries, *change.path)
+				applied = append(applied, Change{change.path, REMOVE, change.timestamp, nil, nil})
+				continue
+			}
+			c.entries[*change.path] = d
+			applied = append(applied, Change{d.path, PUT, d.tstamp, d.value, d.err})
+		default:
+			d := Data{path: change.path, value: change.value, tstamp: change.timestamp, err: change.err}
+			c.entries[*change.path] = d
+			applied = append(applied, change)
+		}
+	}
+	c.lastUpdate = time.Now()
+	hooks := c.hooks
+	c.mu.Unlock()
+
+	for _, hook := range hooks {
+		hook := hook
+		if c.w.executor != nil {
+			if !c.w.executor.submit(changes[0].path.ToString(), func() { hook(applied) }) {
+				logger.WithField("path", changes[0].path).Debug("Cache : hook dropped by executor (full or shut down)")
+			}
+		} else {
+			hook(applied)
+		}
+	}
+}
@@ -0,0 +1,120 @@
+/*
+ * Copyright (c) 2017, 2020 ADLINK Technology Inc.
+ *
+ * This program and the accompanying materials are made available under the
+ * terms of the Eclipse Public License 2.0 which is available at
+ * http://www.eclipse.org/legal/epl-2.0, or the Apache License, Version 2.0
+ * which is available at https://www.apache.org/licenses/LICENSE-2.0.
+ *
+ * SPDX-License-Identifier: EPL-2.0 OR Apache-2.0
+ *
+ * Contributors:
+ *   ADLINK zenoh team, <zenoh@adlink-labs.tech>
+ */
+
+package zenoh
+
+import (
+	"sync"
+	"testing"
+	"time"
+)
+
+func newTestCache(t *testing.T, selector string) *Cache {
+	s, err := NewSelector(selector)
+	if err != nil {
+		t.Fatal(err)
+	}
+	filter, err := s.Filter()
+	if err != nil {
+		t.Fatal(err)
+	}
+	root, _ := NewPath("/test")
+	return &Cache{w: &Workspace{path: root}, selector: s, filter: filter, mu: new(sync.RWMutex), entries: make(map[Path]Data),
+		lastUpdate: time.Now()}
+}
+
+func TestCacheApply(t *testing.T) {
+	c := newTestCache(t, "/test/**?x>1")
+	a, _ := NewPath("/test/a")
+	b, _ := NewPath("/test/b")
+	c.apply([]Change{{a, PUT, testTimestamp(1), &JSONValue{[]byte(`{"x":2,"y":1}`)}, nil}})
+	c.apply([]Change{{b, PUT, testTimestamp(2), &JSONValue{[]byte(`{"x":3}`)}, nil}})
+	if len(c.Snapshot()) != 2 {
+		t.Fatalf("Snapshot() has %d entries, expected 2", len(c.Snapshot()))
+	}
+
+	c.apply([]Change{{a, UPDATE, testTimestamp(3), &JSONValue{[]byte(`{"y":2}`)}, nil}})
+	if d := c.Get(a); d == nil || d.Value().ToString() != `{"x":2,"y":2}` {
+		t.Errorf("Get(%s) = %v after UPDATE", a.ToString(), d)
+	}
+	// an UPDATE making the value no longer satisfy the predicate removes the path
+	c.apply([]Change{{a, UPDATE, testTimestamp(4), &JSONValue{[]byte(`{"x":0}`)}, nil}})
+	if d := c.Get(a); d != nil {
+		t.Errorf("Get(%s) = %v, expected nil as x<=1", a.ToString(), d.Value().ToString())
+	}
+	c.apply([]Change{{b, REMOVE, testTimestamp(5), nil, nil}})
+	if len(c.Snapshot()) != 0 {
+		t.Errorf("Snapshot() has %d entries, expected 0", len(c.Snapshot()))
+	}
+}
+
+func TestCacheIsStale(t *testing.T) {
+	c := newTestCache(t, "/test/**")
+	if c.IsStale(time.Hour) {
+		t.Error("new Cache is stale")
+	}
+	c.lastUpdate = time.Now().Add(-2 * time.Hour)
+	if !c.IsStale(time.Hour) {
+		t.Error("Cache not updated for 2 hours is not stale")
+	}
+	c.closed = true
+	if !c.IsStale(0) {
+		t.Error("closed Cache is not stale")
+	}
+}
+
+func TestCacheRelativePaths(t *testing.T) {
+	c := newTestCache(t, "/test/**")
+	a, _ := NewPath("/test/x/a")
+	c.apply([]Change{{a, PUT, testTimestamp(1), NewIntValue(1), nil}})
+	rel, _ := NewPath("x/a")
+	if d := c.Get(rel); d == nil || d.Value().ToString() != "1" {
+		t.Errorf("Get(%s) = %v, expected the Data of %s", rel.ToString(), d, a.ToString())
+	}
+	prefix, _ := NewPath("x")
+	if l := c.List(prefix); len(l) != 1 {
+		t.Errorf("List(%s) returned %d Data, expected 1", prefix.ToString(), len(l))
+	}
+}
+
+func TestCacheOnChange(t *testing.T) {
+	c := newTestCache(t, "/test/**?x>1")
+	var notified []Change
+	c.OnChange(func(changes []Change) { notified = append(notified, changes...) })
+	a, _ := NewPath("/test/a")
+	c.apply([]Change{{a, PUT, testTimestamp(1), &JSONValue{[]byte(`{"x":2,"y":1}`)}, nil}})
+	c.apply([]Change{{a, UPDATE, testTimestamp(2), &JSONValue{[]byte(`{"y":2}`)}, nil}})
+	c.apply([]Change{{a, UPDATE, testTimestamp(3), &JSONValue{[]byte(`{"x":0}`)}, nil}})
+
+	expected := []struct {
+		kind  ChangeKind
+		value string
+	}{
+		{PUT, `{"x":2,"y":1}`},
+		{PUT, `{"x":2,"y":2}`},
+		{REMOVE, ""},
+	}
+	if len(notified) != len(expected) {
+		t.Fatalf("%d changes notified, expected %d", len(notified), len(expected))
+	}
+	for i, e := range expected {
+		value := ""
+		if notified[i].Value() != nil {
+			value = notified[i].Value().ToString()
+		}
+		if notified[i].Kind() != e.kind || value != e.value {
+			t.Errorf("change %d is %d %s, expected %d %s", i, notified[i].Kind(), value, e.kind, e.value)
+		}
+	}
+}
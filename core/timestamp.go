@@ -45,6 +45,14 @@ func GenerateTimestamp() *Timestamp {
 	return ts
 }
 
+// NewTimestamp creates a Timestamp from its time (as returned by Time()) and its clock identifier.
+func NewTimestamp(t uint64, clockID [16]byte) *Timestamp {
+	ts := new(Timestamp)
+	ts.time = C.ulong(t)
+	ts.clock_id = *(*[16]C.uchar)(unsafe.Pointer(&clockID))
+	return ts
+}
+
 // Time returns the  time as a 64-bit long, where:
 //   - The higher 32-bit represent the number of seconds
 //       since midnight, January 1, 1970 UTC
@@ -0,0 +1,375 @@
+/*
+ * Copyright (c) 2017, 2020 ADLINK Technology Inc.
+ *
+ * This program and the accompanying materials are made available under the
+ * terms of the Eclipse Public License 2.0 which is available at
+ * http://www.eclipse.org/legal/epl-2.0, or the Apache License, Version 2.0
+ * which is available at https://www.apache.org/licenses/LICENSE-2.0.
+ *
+ * SPDX-License-Identifier: EPL-2.0 OR Apache-2.0
+ *
+ * Contributors:
+ *   ADLINK zenoh team, <zenoh@adlink-labs.tech>
+ */
+
+package zenoh
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"runtime/debug"
+	"time"
+
+	znet "github.com/eclipse-zenoh/zenoh-go/net"
+	log "github.com/sirupsen/logrus"
+)
+
+// EvalResult is a path/value returned by a DataEval, with the kind of change it represents.
+type EvalResult struct {
+	// Path is the path of the result. If nil, the Path of the eval is used.
+	// If relative, it's relative to the Workspace's path.
+	Path *Path
+	// Value is the value of the result. It can be nil for a REMOVE.
+	Value Value
+	// Kind is the kind of change (PUT, UPDATE or REMOVE).
+	Kind ChangeKind
+}
+
+// DataEval defines the callback function that has to be registered for evals
+// returning zero or several path/values, or an error (see Workspace.RegisterDataEval()).
+type DataEval func(path *Path, props Properties) ([]EvalResult, error)
+
+// EvalRequest is a query received by an EvalHandler (see Workspace.RegisterEvalHandler()).
+type EvalRequest struct {
+	ctx      context.Context
+	path     *Path
+	selector *Selector
+	props    Properties
+}
+
+// Context returns the context of the request. It's cancelled when the eval is unregistered
+// (including by Workspace.Close() and Zenoh.Logout()), or when the timeout configured
+// at registration expires.
+// Notice that it's not cancelled when the querier stops waiting for the replies,
+// as zenoh-net doesn't notify it.
+func (r *EvalRequest) Context() context.Context {
+	return r.ctx
+}
+
+// Path returns the queried Path
+func (r *EvalRequest) Path() *Path {
+	return r.path
+}
+
+// Selector returns the full Selector of the query
+func (r *EvalRequest) Selector() *Selector {
+	return r.selector
+}
+
+// Predicate returns the predicate of the query (i.e. the filter part of its Selector)
+func (r *EvalRequest) Predicate() string {
+	return r.selector.Predicate()
+}
+
+// Properties returns the properties of the query, completed with the
+// segments captured by the PathExpr of the eval (if any).
+func (r *EvalRequest) Properties() Properties {
+	return r.props
+}
+
+// EvalHandler defines the callback function that has to be registered for evals
+// taking an EvalRequest (see Workspace.RegisterEvalHandler()).
+type EvalHandler func(req *EvalRequest) ([]EvalResult, error)
+
+// EvalOptions configures an eval registration (see Workspace.RegisterEvalHandler()).
+type EvalOptions struct {
+	// Timeout is the maximum duration of the handling of a query, including the time
+	// waiting for the executor of the Workspace. Once expired, the context of the
+	// EvalRequest is cancelled. If 0, there is no timeout.
+	Timeout time.Duration
+}
+
+// registeredEval is an eval registered by a Workspace.
+type registeredEval struct {
+	zeval  *znet.Eval
+	cancel context.CancelFunc
+}
+
+// evalError is the error sent by an eval to the querier.
+type evalError struct {
+	Msg  string `json:"msg"`
+	Code int    `json:"code"`
+}
+
+// RegisterDataEval registers a DataEval function under the provided Path.
+//
+// For each query, the EvalResults returned by eval are sent to the querier, each with its own
+// path, encoding and kind. If eval returns an error (or panics), the error is sent instead to
+// the queriers using zenoh-go (the other queriers get no reply), and the querier gets it in the
+// ErrorList Cause of the error returned by GetWithContext(). If the error is a *ZError,
+// its Code is preserved.
+//
+// It returns an error if an eval is already registered under the same Path via the Workspace.
+func (w *Workspace) RegisterDataEval(path *Path, eval DataEval) error {
+	return w.registerEval(pathExprOf(w.toAbsolutePath(path)), dataEvalHandler(eval), nil)
+}
+
+// RegisterPathEval registers a DataEval function under the provided PathExpr.
+//
+// The eval function is called with the queried Path, and with the properties of the query
+// completed with the segments of the Path captured by the PathExpr (overriding the
+// properties with the same names).
+// As the eval function needs a Path, it's not called for the queries on path expressions
+// with wildcards not matching a single Path (the eval replies nothing to such queries).
+//
+// The EvalResults returned by eval and its errors are sent as for RegisterDataEval(),
+// the default path of a result being the queried Path.
+func (w *Workspace) RegisterPathEval(expr *PathExpr, eval DataEval) error {
+	return w.registerEval(w.toAbsolutePathExpr(expr), dataEvalHandler(eval), nil)
+}
+
+// RegisterEvalHandler registers an EvalHandler function under the provided PathExpr,
+// as RegisterPathEval() does, but passing to handler an EvalRequest, with the full Selector
+// of the query and a context. If opts is nil, the default EvalOptions are used (i.e. no timeout).
+//
+// The handler should stop its processing when the context is done. The errors it returns
+// are sent to the querier (see RegisterDataEval()).
+// The eval can be unregistered with UnregisterEval().
+func (w *Workspace) RegisterEvalHandler(expr *PathExpr, handler EvalHandler, opts *EvalOptions) error {
+	return w.registerEval(w.toAbsolutePathExpr(expr), handler, opts)
+}
+
+// dataEvalHandler returns an EvalHandler calling a DataEval.
+func dataEvalHandler(eval DataEval) EvalHandler {
+	return func(req *EvalRequest) ([]EvalResult, error) {
+		return eval(req.path, req.props)
+	}
+}
+
+func (w *Workspace) registerEval(pe *PathExpr, handler EvalHandler, opts *EvalOptions) error {
+	if opts == nil {
+		opts = new(EvalOptions)
+	}
+	logger := logger.WithField("path", pe.ToString())
+	logger.Debug("RegisterEval")
+	w.mu.Lock()
+	err := w.checkEvalFree(pe)
+	w.mu.Unlock()
+	if err != nil {
+		return err
+	}
+	// cancelled at unregistration
+	evalCtx, cancel := context.WithCancel(context.Background())
+
+	zQueryHandler := func(rname string, predicate string, repliesSender *znet.RepliesSender) {
+		logger.WithFields(log.Fields{
+			"rname":     rname,
+			"predicate": predicate,
+		}).Debug("Registered eval handling query")
+		ctx, cancelReq := evalCtx, context.CancelFunc(func() {})
+		if opts.Timeout > 0 {
+			ctx, cancelReq = context.WithTimeout(evalCtx, opts.Timeout)
+		}
+		req, extReplies, err := newEvalRequest(ctx, pe, rname, predicate)
+		if err != nil {
+			logger.WithField("rname", rname).Warn("Registered eval received query for an invalid selector")
+			cancelReq()
+			repliesSender.SendReplies(nil)
+			return
+		}
+		if req == nil {
+			logger.WithField("rname", rname).Debug("Registered eval : query not handled as rname is not a matching path")
+			cancelReq()
+			repliesSender.SendReplies(nil)
+			return
+		}
+		p := req.path
+
+		evalRoutine := func() {
+			defer cancelReq()
+			replied := false
+			replyError := func(err error) {
+				replied = true
+				if extReplies {
+					repliesSender.SendReplies([]znet.Resource{encodeEvalError(p, err)})
+				} else {
+					repliesSender.SendReplies(nil)
+				}
+			}
+			// callEval recovers the panics of the eval, but not of the middlewares:
+			// reply with the error rather than leaving the panic to zenoh-net
+			defer func() {
+				if r := recover(); r != nil {
+					err := queryPanic(logger, rname, r)
+					if !replied {
+						replyError(err)
+					}
+				}
+			}()
+			var results []EvalResult
+			err := w.intercept(&Invocation{Op: OpEval, Target: p.ToString(), Context: ctx, Request: req}, func() error {
+				var err error
+				results, err = callEval(handler, req)
+				return err
+			})
+			if err != nil {
+				logger.WithFields(log.Fields{
+					"rname":     rname,
+					"predicate": predicate,
+					"error":     err,
+				}).Warn("Registered eval handling query failed")
+				replyError(err)
+				return
+			}
+			logger.WithFields(log.Fields{
+				"rname":     rname,
+				"predicate": predicate,
+				"results":   len(results),
+			}).Debug("Registered eval handling query returns")
+			replies := make([]znet.Resource, len(results))
+			for i, r := range results {
+				rp := p
+				if r.Path != nil {
+					rp = w.toAbsolutePath(r.Path)
+				}
+				replies[i].RName = rp.ToString()
+				if r.Value != nil {
+					replies[i].Data = r.Value.Encode()
+					replies[i].Encoding = r.Value.Encoding()
+					if extReplies {
+						replies[i].Data = plainReplyData(replies[i].Data)
+					}
+				}
+				replies[i].Kind = r.Kind
+			}
+			replied = true
+			repliesSender.SendReplies(replies)
+		}
+		if w.executor != nil {
+			if !w.executor.submit(rname, evalRoutine) {
+				logger.WithField("rname", rname).Debug("Registered eval : query dropped by executor (full or shut down)")
+				cancelReq()
+				repliesSender.SendReplies(nil)
+			}
+		} else {
+			evalRoutine()
+		}
+	}
+
+	e, err := w.session.DeclareEval(pe.rname, zQueryHandler)
+	if err != nil {
+		cancel()
+		return &ZError{Msg: "RegisterEval on " + pe.ToString() + " failed", Code: 0, Cause: err}
+	}
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	if err := w.track(); err != nil {
+		cancel()
+		w.session.UndeclareEval(e)
+		return &ZError{Msg: "RegisterEval on " + pe.ToString() + " failed", Code: 0, Cause: err}
+	}
+	// registered meanwhile
+	if err := w.checkEvalFree(pe); err != nil {
+		cancel()
+		w.session.UndeclareEval(e)
+		return err
+	}
+	w.evals[pe.ToString()] = &registeredEval{e, cancel}
+	return nil
+}
+
+// newEvalRequest returns the EvalRequest for a query received by the eval registered on pe,
+// and true if the querier supports the extended replies (see propExtReplies).
+// It returns a nil EvalRequest if rname is not a Path matching pe.
+func newEvalRequest(ctx context.Context, pe *PathExpr, rname string, predicate string) (*EvalRequest, bool, error) {
+	s, err := NewSelector(rname + "?" + predicate)
+	if err != nil {
+		return nil, false, err
+	}
+	s, extReplies := withoutExtReplies(s)
+	props := predicateToProperties(s.Properties())
+	var p *Path
+	if pe.IsPath() {
+		p, _ = NewPath(pe.ToString())
+	} else {
+		var ok bool
+		var captured map[string]string
+		if p, err = NewPath(rname); err == nil {
+			ok, captured = pe.Match(p)
+		}
+		if !ok {
+			return nil, extReplies, nil
+		}
+		for k, v := range captured {
+			props[k] = v
+		}
+	}
+	return &EvalRequest{ctx, p, s, props}, extReplies, nil
+}
+
+// checkEvalFree returns an error if an eval is already registered on pe.
+// w.mu must be locked by the caller.
+func (w *Workspace) checkEvalFree(pe *PathExpr) error {
+	if _, ok := w.evals[pe.ToString()]; ok {
+		return &ZError{Msg: "RegisterEval on " + pe.ToString() + " failed: an eval is already registered on it",
+			Code: 0, Cause: nil}
+	}
+	return nil
+}
+
+func (w *Workspace) unregisterEval(expr string) error {
+	w.mu.Lock()
+	re, ok := w.evals[expr]
+	delete(w.evals, expr)
+	w.mu.Unlock()
+	if ok {
+		re.cancel()
+		err := w.session.UndeclareEval(re.zeval)
+		if err != nil {
+			return &ZError{Msg: "UnregisterEval on " + expr + " failed", Code: 0, Cause: err}
+		}
+	}
+	return nil
+}
+
+// callEval calls handler, converting a panic into an error.
+func callEval(handler EvalHandler, req *EvalRequest) (results []EvalResult, err error) {
+	defer func() {
+		if r := recover(); r != nil {
+			results = nil
+			err = &ZError{Msg: fmt.Sprintf("Eval on %s panicked: %v", req.path.ToString(), r), Code: 0, Cause: nil}
+		}
+	}()
+	return handler(req)
+}
+
+// queryPanic logs r, recovered from a panic while handling a query on rname,
+// with its stack trace, and returns it converted into a *ZError.
+func queryPanic(logger *log.Entry, rname string, r interface{}) error {
+	logger.WithFields(log.Fields{
+		"rname": rname,
+		"error": r,
+		"stack": string(debug.Stack()),
+	}).Error("Panic while handling query")
+	return &ZError{Msg: fmt.Sprintf("Panic while handling query on %s: %v", rname, r), Code: 0, Cause: nil}
+}
+
+// encodeEvalError returns the extReplyEvalError reply reporting err to the querier.
+func encodeEvalError(p *Path, err error) znet.Resource {
+	e := evalError{Msg: err.Error()}
+	if zerr, ok := err.(*ZError); ok {
+		e.Code = zerr.Code
+	}
+	buf, _ := json.Marshal(e)
+	return znet.Resource{RName: p.ToString(), Data: extReplyData(extReplyEvalError, buf), Encoding: JSON, Kind: PUT}
+}
+
+// decodeEvalError returns the error reported by an eval on Path p.
+func decodeEvalError(p *Path, data []byte) error {
+	var e evalError
+	if err := json.Unmarshal(data, &e); err != nil {
+		return &ZError{Msg: "Eval on " + p.ToString() + " failed with an undecodable error", Code: 0, Cause: err}
+	}
+	return &ZError{Msg: "Eval on " + p.ToString() + " failed: " + e.Msg, Code: e.Code, Cause: nil}
+}
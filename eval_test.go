@@ -0,0 +1,96 @@
+/*
+ * Copyright (c) 2017, 2020 ADLINK Technology Inc.
+ *
+ * This program and the accompanying materials are made available under the
+ * terms of the Eclipse Public License 2.0 which is available at
+ * http://www.eclipse.org/legal/epl-2.0, or the Apache License, Version 2.0
+ * which is available at https://www.apache.org/licenses/LICENSE-2.0.
+ *
+ * SPDX-License-Identifier: EPL-2.0 OR Apache-2.0
+ *
+ * Contributors:
+ *   ADLINK zenoh team, <zenoh@adlink-labs.tech>
+ */
+
+package zenoh
+
+import (
+	"bytes"
+	"context"
+	"strings"
+	"testing"
+
+	znet "github.com/eclipse-zenoh/zenoh-go/net"
+)
+
+// evalReply returns the ZNEvalData reply carrying r.
+func evalReply(r znet.Resource) *queryReply {
+	return &queryReply{kind: znet.ZNEvalData, srcID: []byte{2}, rname: r.RName, data: r.Data, encoding: r.Encoding}
+}
+
+func TestEvalErrorReply(t *testing.T) {
+	q := newTestQuery(t, "/test/**")
+	p, _ := NewPath("/test/a")
+	q.handle(evalReply(encodeEvalError(p, &ZError{Msg: "no value", Code: 42})))
+	q.handle(&queryReply{kind: znet.ZNReplyFinal})
+	<-q.finished
+
+	if len(q.data) != 0 {
+		t.Errorf("eval error received as %d Data", len(q.data))
+	}
+	if len(q.errs) != 1 {
+		t.Fatalf("%d errors received, expected 1", len(q.errs))
+	}
+	zerr, ok := q.errs[0].(*ZError)
+	if !ok || zerr.Code != 42 || !strings.Contains(zerr.Msg, "/test/a") || !strings.Contains(zerr.Msg, "no value") {
+		t.Errorf("received error %v, expected the eval's error with code 42", q.errs[0])
+	}
+}
+
+func TestEvalValueReply(t *testing.T) {
+	q := newTestQuery(t, "/test/**")
+	// a RAW value which looks like an extended reply
+	raw := append(append([]byte{}, extReplyMagic...), "e{}"...)
+	q.handle(evalReply(znet.Resource{RName: "/test/a", Data: plainReplyData(raw), Encoding: RAW, Kind: PUT}))
+	q.handle(evalReply(znet.Resource{RName: "/test/b", Data: plainReplyData([]byte("b")), Encoding: STRING, Kind: PUT}))
+	q.handle(&queryReply{kind: znet.ZNReplyFinal})
+	<-q.finished
+
+	if len(q.errs) != 0 {
+		t.Errorf("received errors %v", q.errs)
+	}
+	if len(q.data) != 2 {
+		t.Fatalf("%d Data received, expected 2", len(q.data))
+	}
+	if v := q.data[0].Value().Encode(); !bytes.Equal(v, raw) {
+		t.Errorf("received %q, expected %q", v, raw)
+	}
+	if v := q.data[1].Value().ToString(); v != "b" {
+		t.Errorf("received %q, expected \"b\"", v)
+	}
+}
+
+func TestEvalRequest(t *testing.T) {
+	pe, _ := NewPathExpr("/test/{id}/avg")
+	s, _ := NewSelector("/test/s1/avg?x>1(window=10)")
+	ext := withExtReplies(s)
+	req, extReplies, err := newEvalRequest(context.Background(), pe, ext.Path(), ext.OptionalPart())
+	if err != nil || req == nil {
+		t.Fatalf("newEvalRequest(%s) = %v, %v", ext.ToString(), req, err)
+	}
+	if !extReplies {
+		t.Error("extended replies not supported by the querier")
+	}
+	// the property added by the Workspace isn't visible to the eval
+	if req.Predicate() != "x>1" || req.Selector().Properties() != "window=10" {
+		t.Errorf("request with predicate %q and properties %q", req.Predicate(), req.Selector().Properties())
+	}
+	props := req.Properties()
+	if len(props) != 2 || props["window"] != "10" || props["id"] != "s1" {
+		t.Errorf("request with properties %v", props)
+	}
+
+	if req, _, err := newEvalRequest(context.Background(), pe, "/test/s1/s2/avg", ""); err != nil || req != nil {
+		t.Errorf("newEvalRequest() for a not matching path = %v, %v", req, err)
+	}
+}
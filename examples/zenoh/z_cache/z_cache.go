@@ -0,0 +1,86 @@
+/*
+ * Copyright (c) 2017, 2020 ADLINK Technology Inc.
+ *
+ * This program and the accompanying materials are made available under the
+ * terms of the Eclipse Public License 2.0 which is available at
+ * http://www.eclipse.org/legal/epl-2.0, or the Apache License, Version 2.0
+ * which is available at https://www.apache.org/licenses/LICENSE-2.0.
+ *
+ * SPDX-License-Identifier: EPL-2.0 OR Apache-2.0
+ *
+ * Contributors:
+ *   ADLINK zenoh team, <zenoh@adlink-labs.tech>
+ */
+
+package main
+
+import (
+	"fmt"
+	"os"
+
+	"github.com/alexflint/go-arg"
+	"github.com/eclipse-zenoh/zenoh-go"
+)
+
+func main() {
+	// --- Command line argument parsing --- --- --- --- --- ---
+	var args struct {
+		Selector string `default:"/zenoh/examples/**" arg:"-s" help:"The selector of the path/values to cache"`
+		Locator  string `arg:"-l" help:"The locator to be used to boostrap the zenoh session. By default dynamic discovery is used"`
+	}
+	arg.MustParse(&args)
+
+	// zenoh-net code  --- --- --- --- --- --- --- --- --- --- ---
+	s, err := zenoh.NewSelector(args.Selector)
+	if err != nil {
+		panic(err.Error())
+	}
+
+	fmt.Println("Login to Zenoh...")
+	y, err := zenoh.Login(&args.Locator, nil)
+	if err != nil {
+		panic(err.Error())
+	}
+
+	fmt.Println("Use Workspace on '/'")
+	root, _ := zenoh.NewPath("/")
+	w := y.Workspace(root)
+
+	fmt.Println("Cache " + args.Selector)
+	cache, err := w.Cache(s)
+	if err != nil {
+		panic(err.Error())
+	}
+	cache.OnChange(func(changes []zenoh.Change) {
+		for _, c := range changes {
+			if c.Kind() == zenoh.REMOVE {
+				fmt.Printf(">> [Cache] '%s' removed\n", c.Path().ToString())
+			} else {
+				fmt.Printf(">> [Cache] '%s' is now '%s'\n", c.Path().ToString(), c.Value().ToString())
+			}
+		}
+	})
+
+	fmt.Println("Enter 'l' to list the cached values, 'q' to quit...")
+	fmt.Println()
+	var b = make([]byte, 1)
+	for b[0] != 'q' {
+		if b[0] == 'l' {
+			for _, d := range cache.Snapshot() {
+				fmt.Printf("  %s : %s\n", d.Path().ToString(), d.Value().ToString())
+			}
+			fmt.Printf("  (last update: %s)\n", cache.LastUpdate().Format("15:04:05.000"))
+		}
+		os.Stdin.Read(b)
+	}
+
+	err = cache.Close()
+	if err != nil {
+		panic(err.Error())
+	}
+
+	err = y.Logout()
+	if err != nil {
+		panic(err.Error())
+	}
+}
@@ -0,0 +1,106 @@
+/*
+ * Copyright (c) 2017, 2020 ADLINK Technology Inc.
+ *
+ * This program and the accompanying materials are made available under the
+ * terms of the Eclipse Public License 2.0 which is available at
+ * http://www.eclipse.org/legal/epl-2.0, or the Apache License, Version 2.0
+ * which is available at https://www.apache.org/licenses/LICENSE-2.0.
+ *
+ * SPDX-License-Identifier: EPL-2.0 OR Apache-2.0
+ *
+ * Contributors:
+ *   ADLINK zenoh team, <zenoh@adlink-labs.tech>
+ */
+
+package main
+
+import (
+	"fmt"
+	"os"
+	"strconv"
+	"time"
+
+	"github.com/alexflint/go-arg"
+	"github.com/eclipse-zenoh/zenoh-go"
+)
+
+func main() {
+	// --- Command line argument parsing --- --- --- --- --- ---
+	var args struct {
+		Expr    string `default:"/zenoh/examples/go/eval/{name}/count/{n}" arg:"-e" help:"the path expression the eval is registered on"`
+		Locator string `arg:"-l" help:"The locator to be used to boostrap the zenoh session. By default dynamic discovery is used"`
+		Timeout int    `default:"5" help:"The time (in seconds) after which the processing of a query is cancelled"`
+	}
+	arg.MustParse(&args)
+
+	// zenoh-net code  --- --- --- --- --- --- --- --- --- --- ---
+	pe, err := zenoh.NewPathExpr(args.Expr)
+	if err != nil {
+		panic(err.Error())
+	}
+
+	fmt.Println("Login to Zenoh...")
+	y, err := zenoh.Login(&args.Locator, nil)
+	if err != nil {
+		panic(err.Error())
+	}
+
+	fmt.Println("Use Workspace on '/'")
+	root, _ := zenoh.NewPath("/")
+	w := y.WorkspaceWithExecutor(root)
+
+	fmt.Println("Register eval " + pe.ToString())
+	err = w.RegisterEvalHandler(pe,
+		func(req *zenoh.EvalRequest) ([]zenoh.EvalResult, error) {
+			// The segments captured by the path expression are added to the properties of the query.
+			// For example, with the default path expression and the following selectors:
+			//   - "/zenoh/examples/go/eval/Bob/count/3" : 3 values are returned, one per sub-path
+			//   - "/zenoh/examples/go/eval/Bob/count/0" : no value is returned
+			//   - "/zenoh/examples/go/eval/Bob/count/x" : an error is returned to the querier
+			props := req.Properties()
+			fmt.Printf(">> Processing eval for path %s with properties: %s\n", req.Path(), props)
+			n, err := strconv.Atoi(props["n"])
+			if err != nil || n < 0 {
+				return nil, &zenoh.ZError{Msg: "Invalid count: " + props["n"], Code: 0, Cause: nil}
+			}
+
+			results := make([]zenoh.EvalResult, 0, n)
+			for i := 0; i < n; i++ {
+				select {
+				case <-req.Context().Done():
+					fmt.Printf("   >> Cancelled after %d values\n", i)
+					return nil, req.Context().Err()
+				default:
+				}
+				p, _ := zenoh.NewPath(req.Path().ToString() + "/" + strconv.Itoa(i))
+				results = append(results, zenoh.EvalResult{
+					Path:  p,
+					Value: zenoh.NewStringValue(fmt.Sprintf("Eval %d from %s", i, props["name"])),
+					Kind:  zenoh.PUT,
+				})
+			}
+			fmt.Printf("   >> Returning %d values\n", len(results))
+			return results, nil
+		},
+		&zenoh.EvalOptions{Timeout: time.Duration(args.Timeout) * time.Second})
+	if err != nil {
+		panic(err.Error())
+	}
+
+	fmt.Println("Enter 'q' to quit...")
+	fmt.Println()
+	var b = make([]byte, 1)
+	for b[0] != 'q' {
+		os.Stdin.Read(b)
+	}
+
+	err = w.UnregisterEval(pe)
+	if err != nil {
+		panic(err.Error())
+	}
+
+	err = y.Logout()
+	if err != nil {
+		panic(err.Error())
+	}
+}
@@ -15,8 +15,10 @@
 package main
 
 import (
+	"context"
 	"fmt"
 	"strconv"
+	"time"
 
 	"github.com/alexflint/go-arg"
 	"github.com/eclipse-zenoh/zenoh-go"
@@ -27,6 +29,8 @@ func main() {
 	var args struct {
 		Selector string `default:"/zenoh/examples/**" arg:"-s" help:"The selector to be used for issuing the query"`
 		Locator  string `arg:"-l" help:"The locator to be used to boostrap the zenoh session. By default dynamic discovery is used"`
+		Timeout  int    `default:"10" arg:"-t" help:"The time (in seconds) to wait for the replies"`
+		Latency  bool   `help:"Print the duration of the query"`
 	}
 	arg.MustParse(&args)
 
@@ -45,12 +49,23 @@ func main() {
 	fmt.Println("Use Workspace on '/'")
 	root, _ := zenoh.NewPath("/")
 	w := y.Workspace(root)
+	if args.Latency {
+		w.Use(zenoh.LatencyMiddleware(func(inv *zenoh.Invocation, d time.Duration, err error) {
+			fmt.Printf("%s on %s took %v\n", inv.Op.ToString(), inv.Target, d)
+		}))
+	}
 
 	fmt.Println("Get from " + s.ToString())
-	for _, pv := range w.Get(s) {
+	ctx, cancel := context.WithTimeout(context.Background(), time.Duration(args.Timeout)*time.Second)
+	defer cancel()
+	data, err := w.GetWithContext(ctx, s)
+	for _, pv := range data {
 		fmt.Println("  " + pv.Path().ToString() + " : " + pv.Value().ToString() +
 			" - encoding_flag=0x" + strconv.FormatInt(int64(pv.Value().Encoding()), 16))
 	}
+	if err != nil {
+		fmt.Println("Get failed: " + err.Error())
+	}
 
 	err = y.Logout()
 	if err != nil {
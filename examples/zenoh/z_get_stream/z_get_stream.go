@@ -0,0 +1,69 @@
+/*
+ * Copyright (c) 2017, 2020 ADLINK Technology Inc.
+ *
+ * This program and the accompanying materials are made available under the
+ * terms of the Eclipse Public License 2.0 which is available at
+ * http://www.eclipse.org/legal/epl-2.0, or the Apache License, Version 2.0
+ * which is available at https://www.apache.org/licenses/LICENSE-2.0.
+ *
+ * SPDX-License-Identifier: EPL-2.0 OR Apache-2.0
+ *
+ * Contributors:
+ *   ADLINK zenoh team, <zenoh@adlink-labs.tech>
+ */
+
+package main
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"github.com/alexflint/go-arg"
+	"github.com/eclipse-zenoh/zenoh-go"
+)
+
+func main() {
+	// --- Command line argument parsing --- --- --- --- --- ---
+	var args struct {
+		Selector string `default:"/zenoh/examples/**" arg:"-s" help:"The selector to be used for issuing the query"`
+		Locator  string `arg:"-l" help:"The locator to be used to boostrap the zenoh session. By default dynamic discovery is used"`
+		Timeout  int    `default:"10" arg:"-t" help:"The time (in seconds) to wait for the replies"`
+	}
+	arg.MustParse(&args)
+
+	// zenoh-net code  --- --- --- --- --- --- --- --- --- --- ---
+	s, err := zenoh.NewSelector(args.Selector)
+	if err != nil {
+		panic(err.Error())
+	}
+
+	fmt.Println("Login to Zenoh...")
+	y, err := zenoh.Login(&args.Locator, nil)
+	if err != nil {
+		panic(err.Error())
+	}
+
+	fmt.Println("Use Workspace on '/'")
+	root, _ := zenoh.NewPath("/")
+	w := y.Workspace(root)
+
+	fmt.Println("Get stream from " + s.ToString())
+	ctx, cancel := context.WithTimeout(context.Background(), time.Duration(args.Timeout)*time.Second)
+	defer cancel()
+	ds, err := w.GetStream(ctx, s, &zenoh.StreamOptions{BufferSize: 16, Consolidate: true})
+	if err != nil {
+		panic(err.Error())
+	}
+	for d := range ds.C() {
+		fmt.Printf("  %s : %s (from %x)\n", d.Path().ToString(), d.Value().ToString(), d.SourceID())
+	}
+	if err := ds.Err(); err != nil {
+		fmt.Println("Get stream failed: " + err.Error())
+	}
+
+	err = y.Logout()
+	if err != nil {
+		panic(err.Error())
+	}
+}
@@ -0,0 +1,79 @@
+/*
+ * Copyright (c) 2017, 2020 ADLINK Technology Inc.
+ *
+ * This program and the accompanying materials are made available under the
+ * terms of the Eclipse Public License 2.0 which is available at
+ * http://www.eclipse.org/legal/epl-2.0, or the Apache License, Version 2.0
+ * which is available at https://www.apache.org/licenses/LICENSE-2.0.
+ *
+ * SPDX-License-Identifier: EPL-2.0 OR Apache-2.0
+ *
+ * Contributors:
+ *   ADLINK zenoh team, <zenoh@adlink-labs.tech>
+ */
+
+package main
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"github.com/alexflint/go-arg"
+	"github.com/eclipse-zenoh/zenoh-go"
+)
+
+// Sensor is the structure put and got as a JSON value
+type Sensor struct {
+	Name        string  `json:"name"`
+	Temperature float64 `json:"temperature"`
+}
+
+func main() {
+	// --- Command line argument parsing --- --- --- --- --- ---
+	var args struct {
+		Path    string  `default:"/zenoh/examples/go/json/sensor" arg:"-p" help:"the path representing the URI"`
+		Locator string  `arg:"-l" help:"The locator to be used to boostrap the zenoh session. By default dynamic discovery is used"`
+		Name    string  `default:"sensor-1" arg:"-n" help:"The name of the sensor"`
+		Temp    float64 `default:"21.5" arg:"-t" help:"The temperature of the sensor"`
+		Timeout int     `default:"5" help:"The time (in seconds) to wait for the value"`
+	}
+	arg.MustParse(&args)
+
+	// zenoh-net code  --- --- --- --- --- --- --- --- --- --- ---
+	p, err := zenoh.NewPath(args.Path)
+	if err != nil {
+		panic(err.Error())
+	}
+
+	fmt.Println("Login to Zenoh...")
+	y, err := zenoh.Login(&args.Locator, nil)
+	if err != nil {
+		panic(err.Error())
+	}
+
+	root, _ := zenoh.NewPath("/")
+	w := y.Workspace(root)
+
+	sensor := Sensor{args.Name, args.Temp}
+	fmt.Printf("PutJSON on %s : %+v\n", p.ToString(), sensor)
+	err = w.PutJSON(p, sensor)
+	if err != nil {
+		panic(err.Error())
+	}
+
+	var got Sensor
+	ctx, cancel := context.WithTimeout(context.Background(), time.Duration(args.Timeout)*time.Second)
+	err = w.GetJSON(ctx, p, &got)
+	cancel()
+	if err != nil {
+		fmt.Println("GetJSON failed: " + err.Error())
+	} else {
+		fmt.Printf("GetJSON on %s : %+v\n", p.ToString(), got)
+	}
+
+	err = y.Logout()
+	if err != nil {
+		panic(err.Error())
+	}
+}
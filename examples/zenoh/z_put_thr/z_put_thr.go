@@ -27,6 +27,7 @@ func main() {
 		Size    int    `default:"256" arg:"-s"help:"the size in bytes of the payload used for the throughput test"`
 		Locator string `arg:"-l" help:"The locator to be used to boostrap the zenoh session. By default dynamic discovery is used"`
 		Path    string `default:"/zenoh/examples/throughput/data" arg:"-p" help:"the resource used to write throughput data"`
+		NoPub   bool   `arg:"--no-pub" help:"Put via the Workspace rather than via a Publisher declared on the path"`
 	}
 	arg.MustParse(&args)
 
@@ -54,8 +55,16 @@ func main() {
 
 	fmt.Printf("Put on %s : %db\n", p.ToString(), len(data))
 
+	put := func() error { return w.Put(p, v) }
+	if !args.NoPub {
+		pub, err := w.Publisher(p)
+		if err != nil {
+			panic(err.Error())
+		}
+		put = func() error { return pub.Put(v) }
+	}
 	for {
-		err = w.Put(p, v)
+		err = put()
 		if err != nil {
 			panic(err.Error())
 		}
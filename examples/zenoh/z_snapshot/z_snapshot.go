@@ -0,0 +1,82 @@
+/*
+ * Copyright (c) 2017, 2020 ADLINK Technology Inc.
+ *
+ * This program and the accompanying materials are made available under the
+ * terms of the Eclipse Public License 2.0 which is available at
+ * http://www.eclipse.org/legal/epl-2.0, or the Apache License, Version 2.0
+ * which is available at https://www.apache.org/licenses/LICENSE-2.0.
+ *
+ * SPDX-License-Identifier: EPL-2.0 OR Apache-2.0
+ *
+ * Contributors:
+ *   ADLINK zenoh team, <zenoh@adlink-labs.tech>
+ */
+
+package main
+
+import (
+	"fmt"
+	"os"
+
+	"github.com/alexflint/go-arg"
+	"github.com/eclipse-zenoh/zenoh-go"
+)
+
+func main() {
+	// --- Command line argument parsing --- --- --- --- --- ---
+	var args struct {
+		Selector string `default:"/zenoh/examples/**" arg:"-s" help:"The selector of the keys/values to export"`
+		Locator  string `arg:"-l" help:"The locator to be used to boostrap the zenoh session. By default dynamic discovery is used"`
+		File     string `default:"snapshot.jsonl" arg:"-f" help:"The snapshot file"`
+		Import   bool   `arg:"-i" help:"Import the snapshot file, instead of exporting the selection into it"`
+	}
+	arg.MustParse(&args)
+
+	// zenoh-net code  --- --- --- --- --- --- --- --- --- --- ---
+	fmt.Println("Login to Zenoh...")
+	y, err := zenoh.Login(&args.Locator, nil)
+	if err != nil {
+		panic(err.Error())
+	}
+
+	fmt.Println("Use Workspace on '/'")
+	root, _ := zenoh.NewPath("/")
+	w := y.Workspace(root)
+
+	if args.Import {
+		f, err := os.Open(args.File)
+		if err != nil {
+			panic(err.Error())
+		}
+		fmt.Println("Import " + args.File)
+		report, err := w.Import(f)
+		f.Close()
+		if err != nil {
+			panic(err.Error())
+		}
+		fmt.Printf("%d records imported\n", report.Imported)
+		for _, failure := range report.Failures {
+			fmt.Printf("  line %d (%s): %s\n", failure.Line, failure.Path, failure.Err.Error())
+		}
+	} else {
+		s, err := zenoh.NewSelector(args.Selector)
+		if err != nil {
+			panic(err.Error())
+		}
+		f, err := os.Create(args.File)
+		if err != nil {
+			panic(err.Error())
+		}
+		fmt.Println("Export " + s.ToString() + " into " + args.File)
+		err = w.Export(s, f)
+		f.Close()
+		if err != nil {
+			panic(err.Error())
+		}
+	}
+
+	err = y.Logout()
+	if err != nil {
+		panic(err.Error())
+	}
+}
@@ -0,0 +1,101 @@
+/*
+ * Copyright (c) 2017, 2020 ADLINK Technology Inc.
+ *
+ * This program and the accompanying materials are made available under the
+ * terms of the Eclipse Public License 2.0 which is available at
+ * http://www.eclipse.org/legal/epl-2.0, or the Apache License, Version 2.0
+ * which is available at https://www.apache.org/licenses/LICENSE-2.0.
+ *
+ * SPDX-License-Identifier: EPL-2.0 OR Apache-2.0
+ *
+ * Contributors:
+ *   ADLINK zenoh team, <zenoh@adlink-labs.tech>
+ */
+
+package main
+
+import (
+	"fmt"
+	"os"
+	"time"
+
+	"github.com/alexflint/go-arg"
+	"github.com/eclipse-zenoh/zenoh-go"
+)
+
+func main() {
+	// --- Command line argument parsing --- --- --- --- --- ---
+	var args struct {
+		Selector string `default:"/zenoh/examples/**" arg:"-s" help:"the selector associated with this storage"`
+		Locator  string `arg:"-l" help:"The locator to be used to boostrap the zenoh session. By default dynamic discovery is used"`
+		Dir      string `arg:"-d" help:"The directory of a persistent log storage. By default the storage is in memory, keeping the history of each key"`
+		MaxAge   int    `help:"The maximum age (in seconds) of the stored values. By default there is no limit"`
+	}
+	arg.MustParse(&args)
+
+	// zenoh-net code  --- --- --- --- --- --- --- --- --- --- ---
+	s, err := zenoh.NewSelector(args.Selector)
+	if err != nil {
+		panic(err.Error())
+	}
+
+	var backend zenoh.StorageBackend
+	if args.Dir != "" {
+		fmt.Println("Open log storage in " + args.Dir)
+		lb, err := zenoh.NewLogBackend(args.Dir, nil)
+		if err != nil {
+			panic(err.Error())
+		}
+		defer lb.Close()
+		backend = lb
+	} else {
+		backend = zenoh.NewHistoryBackend(nil)
+	}
+
+	opts := new(zenoh.StorageOptions)
+	if args.MaxAge > 0 {
+		all, _ := zenoh.NewPathExpr(s.Path())
+		opts.Retention = []zenoh.RetentionRule{{
+			Expr:   all,
+			MaxAge: time.Duration(args.MaxAge) * time.Second,
+			OnEvict: func(stats zenoh.RetentionStats) {
+				if stats.EvictedPaths > 0 || stats.EvictedSamples > 0 {
+					fmt.Printf(">> Evicted %d keys and %d samples\n", stats.EvictedPaths, stats.EvictedSamples)
+				}
+			},
+		}}
+	}
+
+	fmt.Println("Login to Zenoh...")
+	y, err := zenoh.Login(&args.Locator, nil)
+	if err != nil {
+		panic(err.Error())
+	}
+
+	fmt.Println("Use Workspace on '/'")
+	root, _ := zenoh.NewPath("/")
+	w := y.WorkspaceWithExecutor(root)
+
+	fmt.Println("Register storage with selector " + s.ToString())
+	err = w.RegisterStorageWithOptions(s, backend, opts)
+	if err != nil {
+		panic(err.Error())
+	}
+
+	fmt.Println("Enter 'q' to quit...")
+	fmt.Println()
+	var b = make([]byte, 1)
+	for b[0] != 'q' {
+		os.Stdin.Read(b)
+	}
+
+	err = w.UnregisterStorage(s)
+	if err != nil {
+		panic(err.Error())
+	}
+
+	err = y.Logout()
+	if err != nil {
+		panic(err.Error())
+	}
+}
@@ -0,0 +1,126 @@
+/*
+ * Copyright (c) 2017, 2020 ADLINK Technology Inc.
+ *
+ * This program and the accompanying materials are made available under the
+ * terms of the Eclipse Public License 2.0 which is available at
+ * http://www.eclipse.org/legal/epl-2.0, or the Apache License, Version 2.0
+ * which is available at https://www.apache.org/licenses/LICENSE-2.0.
+ *
+ * SPDX-License-Identifier: EPL-2.0 OR Apache-2.0
+ *
+ * Contributors:
+ *   ADLINK zenoh team, <zenoh@adlink-labs.tech>
+ */
+
+package main
+
+import (
+	"fmt"
+	"os"
+
+	"github.com/alexflint/go-arg"
+	"github.com/eclipse-zenoh/zenoh-go"
+)
+
+var policies = map[string]zenoh.OverflowPolicy{
+	"block":       zenoh.OverflowBlock,
+	"drop-oldest": zenoh.OverflowDropOldest,
+	"drop-newest": zenoh.OverflowDropNewest,
+	"keep-latest": zenoh.OverflowKeepLatest,
+}
+
+func main() {
+	// --- Command line argument parsing --- --- --- --- --- ---
+	var args struct {
+		Selector string `default:"/zenoh/examples/**" arg:"-s" help:"The selector specifying the subscription"`
+		Locator  string `arg:"-l" help:"The locator to be used to boostrap the zenoh session. By default dynamic discovery is used"`
+		Buffer   int    `default:"16" arg:"-b" help:"The number of changes that can be buffered"`
+		Overflow string `default:"drop-oldest" arg:"-o" help:"The policy when the buffer is full: block, drop-oldest, drop-newest or keep-latest"`
+		Pull     bool   `arg:"-p" help:"Subscribe in pull mode: the changes are received only when pulled"`
+	}
+	arg.MustParse(&args)
+
+	policy, ok := policies[args.Overflow]
+	if !ok {
+		panic("Invalid overflow policy: " + args.Overflow)
+	}
+
+	// zenoh-net code  --- --- --- --- --- --- --- --- --- --- ---
+	s, err := zenoh.NewSelector(args.Selector)
+	if err != nil {
+		panic(err.Error())
+	}
+
+	fmt.Println("Login to Zenoh...")
+	y, err := zenoh.Login(&args.Locator, nil)
+	if err != nil {
+		panic(err.Error())
+	}
+
+	fmt.Println("Use Workspace on '/'")
+	root, _ := zenoh.NewPath("/")
+	w := y.Workspace(root)
+
+	fmt.Println("Subscribe on " + args.Selector)
+	opts := &zenoh.ChanOptions{BufferSize: args.Buffer, Overflow: policy}
+	if args.Pull {
+		opts.Mode = zenoh.PullMode
+	}
+	sub, err := w.SubscribeChan(s, opts)
+	if err != nil {
+		panic(err.Error())
+	}
+
+	quit := make(chan struct{})
+	go func() {
+		var b = make([]byte, 1)
+		for b[0] != 'q' {
+			os.Stdin.Read(b)
+			if b[0] == 'p' && args.Pull {
+				if err := sub.Pull(); err != nil {
+					fmt.Println(err.Error())
+				}
+			}
+		}
+		close(quit)
+	}()
+
+	if args.Pull {
+		fmt.Println("Enter 'p' to pull the changes, 'q' to quit...")
+	} else {
+		fmt.Println("Enter 'q' to quit...")
+	}
+	fmt.Println()
+loop:
+	for {
+		select {
+		case c, ok := <-sub.C():
+			if !ok {
+				break loop
+			}
+			switch c.Kind() {
+			case zenoh.PUT:
+				fmt.Printf(">> [Subscription channel] Received PUT on '%s': '%s')\n", c.Path().ToString(), c.Value().ToString())
+			case zenoh.UPDATE:
+				fmt.Printf(">> [Subscription channel] Received UPDATE on '%s': '%s')\n", c.Path().ToString(), c.Value().ToString())
+			case zenoh.REMOVE:
+				fmt.Printf(">> [Subscription channel] Received REMOVE on '%s')\n", c.Path().ToString())
+			default:
+				fmt.Printf(">> [Subscription channel] Received unknown operation with kind '%d' on '%s')\n", c.Kind(), c.Path().ToString())
+			}
+		case <-quit:
+			break loop
+		}
+	}
+
+	fmt.Printf("%d changes dropped because of the '%s' policy\n", sub.Dropped(), args.Overflow)
+	err = sub.Close()
+	if err != nil {
+		panic(err.Error())
+	}
+
+	err = y.Logout()
+	if err != nil {
+		panic(err.Error())
+	}
+}
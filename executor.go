@@ -0,0 +1,139 @@
+/*
+ * Copyright (c) 2017, 2020 ADLINK Technology Inc.
+ *
+ * This program and the accompanying materials are made available under the
+ * terms of the Eclipse Public License 2.0 which is available at
+ * http://www.eclipse.org/legal/epl-2.0, or the Apache License, Version 2.0
+ * which is available at https://www.apache.org/licenses/LICENSE-2.0.
+ *
+ * SPDX-License-Identifier: EPL-2.0 OR Apache-2.0
+ *
+ * Contributors:
+ *   ADLINK zenoh team, <zenoh@adlink-labs.tech>
+ */
+
+package zenoh
+
+import (
+	"hash/fnv"
+	"runtime"
+	"sync"
+)
+
+// Default values for ExecutorOptions
+const (
+	defaultExecutorQueueSize = 256
+)
+
+// ExecutorOptions configures the executor of a Workspace
+// (see Zenoh.WorkspaceWithExecutorOptions()).
+type ExecutorOptions struct {
+	// Workers is the number of subroutines executing the listeners and eval callbacks.
+	// If 0, the number of CPUs is used.
+	Workers int
+
+	// QueueSize is the maximum number of notifications or queries waiting for each worker.
+	// When a worker's queue is full, the I/O subroutine waits for some room in the queue,
+	// unless DropOnOverflow is set.
+	// If 0, a default size of 256 is used.
+	QueueSize int
+
+	// DropOnOverflow makes the notifications and queries received while the worker's queue
+	// is full dropped, instead of blocking the I/O subroutine. A dropped query is answered
+	// with no replies.
+	//
+	// Set it if the listeners or eval callbacks perform a Get (or any operation waiting for
+	// replies): while the I/O subroutine waits for some room in a queue, it cannot receive
+	// the replies such operation waits for.
+	//
+	// Notice that a Get performed by a listener or an eval callback must not wait for the
+	// replies of an eval registered via the same Workspace: the eval callback might be queued
+	// for the very worker waiting for its replies, and never be executed.
+	DropOnOverflow bool
+}
+
+// executor is a pool of workers executing the tasks submitted by a Workspace.
+// The tasks submitted with the same key are executed by the same worker,
+// in the order of submission.
+type executor struct {
+	queues  []chan func()
+	drop    bool
+	wg      *sync.WaitGroup
+	mu      *sync.RWMutex
+	closed  bool
+	closing chan struct{}
+	once    *sync.Once
+}
+
+func newExecutor(opts *ExecutorOptions) *executor {
+	workers := opts.Workers
+	if workers <= 0 {
+		workers = runtime.NumCPU()
+	}
+	queueSize := opts.QueueSize
+	if queueSize <= 0 {
+		queueSize = defaultExecutorQueueSize
+	}
+
+	e := &executor{make([]chan func(), workers), opts.DropOnOverflow, new(sync.WaitGroup), new(sync.RWMutex),
+		false, make(chan struct{}), new(sync.Once)}
+	e.wg.Add(workers)
+	for i := range e.queues {
+		e.queues[i] = make(chan func(), queueSize)
+		go e.work(e.queues[i])
+	}
+	return e
+}
+
+func (e *executor) work(queue chan func()) {
+	defer e.wg.Done()
+	for task := range queue {
+		task()
+	}
+}
+
+// submit queues a task for the worker associated with key. If the worker's queue is full,
+// it waits for some room in the queue, or drops the task if DropOnOverflow is set.
+// It returns false if the task has not been queued (dropped or executor shut down).
+func (e *executor) submit(key string, task func()) bool {
+	e.mu.RLock()
+	defer e.mu.RUnlock()
+	if e.closed {
+		return false
+	}
+	h := fnv.New32a()
+	h.Write([]byte(key))
+	queue := e.queues[h.Sum32()%uint32(len(e.queues))]
+	if e.drop {
+		select {
+		case queue <- task:
+			return true
+		default:
+			logger.WithField("key", key).Warn("Executor queue is full: task dropped")
+			return false
+		}
+	}
+	select {
+	case queue <- task:
+		return true
+	case <-e.closing:
+		return false
+	}
+}
+
+// shutdown stops accepting tasks and waits for the queued tasks to be executed.
+// It must not be called by a task, which would wait for itself.
+func (e *executor) shutdown() {
+	// release the submitters waiting for some room in a queue
+	e.once.Do(func() { close(e.closing) })
+
+	e.mu.Lock()
+	if !e.closed {
+		e.closed = true
+		for _, q := range e.queues {
+			close(q)
+		}
+	}
+	e.mu.Unlock()
+	e.wg.Wait()
+}
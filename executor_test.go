@@ -0,0 +1,135 @@
+/*
+ * Copyright (c) 2017, 2020 ADLINK Technology Inc.
+ *
+ * This program and the accompanying materials are made available under the
+ * terms of the Eclipse Public License 2.0 which is available at
+ * http://www.eclipse.org/legal/epl-2.0, or the Apache License, Version 2.0
+ * which is available at https://www.apache.org/licenses/LICENSE-2.0.
+ *
+ * SPDX-License-Identifier: EPL-2.0 OR Apache-2.0
+ *
+ * Contributors:
+ *   ADLINK zenoh team, <zenoh@adlink-labs.tech>
+ */
+
+package zenoh
+
+import (
+	"testing"
+	"time"
+)
+
+// blockWorker submits a task blocking the worker of key until the returned channel is closed.
+func blockWorker(t *testing.T, e *executor, key string) chan struct{} {
+	started, release := make(chan struct{}), make(chan struct{})
+	if !e.submit(key, func() { close(started); <-release }) {
+		t.Fatal("submit failed")
+	}
+	<-started
+	return release
+}
+
+func TestExecutorOrder(t *testing.T) {
+	e := newExecutor(&ExecutorOptions{Workers: 4})
+	results := make(chan int, 100)
+	for i := 0; i < 100; i++ {
+		i := i
+		e.submit("/a", func() { results <- i })
+	}
+	e.shutdown()
+	close(results)
+	expected := 0
+	for i := range results {
+		if i != expected {
+			t.Fatalf("task %d executed instead of %d", i, expected)
+		}
+		expected++
+	}
+	if e.submit("/a", func() {}) {
+		t.Error("submit succeeded after shutdown")
+	}
+}
+
+func TestExecutorDropOnOverflow(t *testing.T) {
+	e := newExecutor(&ExecutorOptions{Workers: 1, QueueSize: 1, DropOnOverflow: true})
+	release := blockWorker(t, e, "/a")
+	if !e.submit("/a", func() {}) {
+		t.Error("submit failed with room in the queue")
+	}
+	if e.submit("/a", func() {}) {
+		t.Error("submit succeeded with a full queue")
+	}
+	close(release)
+	e.shutdown()
+}
+
+func TestExecutorShutdownReleasesSubmitters(t *testing.T) {
+	e := newExecutor(&ExecutorOptions{Workers: 1, QueueSize: 1})
+	release := blockWorker(t, e, "/a")
+	e.submit("/a", func() {})
+	submitted := make(chan bool)
+	go func() { submitted <- e.submit("/a", func() {}) }()
+
+	go e.shutdown()
+	select {
+	case ok := <-submitted:
+		if ok {
+			t.Error("blocked submit succeeded after shutdown")
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatal("blocked submit not released by shutdown")
+	}
+	close(release)
+}
+
+func TestExecutorShutdownFromTask(t *testing.T) {
+	e := newExecutor(&ExecutorOptions{Workers: 1})
+	done := make(chan struct{})
+	executed := false
+	e.submit("/a", func() {
+		// a task cannot wait for its own return: shutdown from another subroutine
+		go func() {
+			e.shutdown()
+			close(done)
+		}()
+	})
+	e.submit("/a", func() { executed = true })
+	select {
+	case <-done:
+	case <-time.After(5 * time.Second):
+		t.Fatal("shutdown requested by a task is blocked")
+	}
+	if !executed {
+		t.Error("shutdown didn't wait for the queued task")
+	}
+}
+
+func TestExecutorNestedTask(t *testing.T) {
+	e := newExecutor(&ExecutorOptions{Workers: 1})
+	defer e.shutdown()
+	order := make(chan string, 2)
+	done := make(chan struct{})
+	e.submit("/a", func() {
+		nested := make(chan struct{})
+		// e.g. the eval callback answering a Get performed by the task
+		e.submit("/b", func() {
+			order <- "nested"
+			close(nested)
+			close(done)
+		})
+		select {
+		case <-nested:
+			t.Error("nested task executed while its worker is busy")
+		case <-time.After(50 * time.Millisecond):
+		}
+		order <- "task"
+	})
+	select {
+	case <-done:
+	case <-time.After(5 * time.Second):
+		t.Fatal("nested task not executed after the task")
+	}
+	if first := <-order; first != "task" {
+		t.Errorf("%s executed first", first)
+	}
+}
@@ -0,0 +1,77 @@
+/*
+ * Copyright (c) 2017, 2020 ADLINK Technology Inc.
+ *
+ * This program and the accompanying materials are made available under the
+ * terms of the Eclipse Public License 2.0 which is available at
+ * http://www.eclipse.org/legal/epl-2.0, or the Apache License, Version 2.0
+ * which is available at https://www.apache.org/licenses/LICENSE-2.0.
+ *
+ * SPDX-License-Identifier: EPL-2.0 OR Apache-2.0
+ *
+ * Contributors:
+ *   ADLINK zenoh team, <zenoh@adlink-labs.tech>
+ */
+
+package zenoh
+
+import (
+	"bytes"
+	"encoding/json"
+	"strconv"
+	"strings"
+)
+
+// projectValue returns a new value, with the same type than v, but with only the specified
+// fields of v, which has been received with the specified encoding (JSON).
+// Each field can be a path of nested fields separated by '.'.
+// The fields not existing in v are ignored.
+func projectValue(path *Path, encoding Encoding, v Value, fields []string) (Value, error) {
+	if encoding != JSON {
+		return nil, &ZError{Msg: "Cannot apply fragment to value of " + path.ToString() +
+			": encoding " + strconv.Itoa(int(encoding)) + " is not JSON", Code: 0, Cause: nil}
+	}
+	var doc interface{}
+	decoder := json.NewDecoder(bytes.NewReader(v.Encode()))
+	decoder.UseNumber()
+	if err := decoder.Decode(&doc); err != nil {
+		return nil, &ZError{Msg: "Cannot apply fragment to value of " + path.ToString() +
+			": invalid JSON", Code: 0, Cause: err}
+	}
+	if _, ok := doc.(map[string]interface{}); !ok {
+		return nil, &ZError{Msg: "Cannot apply fragment to value of " + path.ToString() +
+			": JSON value is not an object", Code: 0, Cause: nil}
+	}
+
+	result := make(map[string]interface{})
+	for _, field := range fields {
+		field = strings.TrimSpace(field)
+		if len(field) == 0 {
+			continue
+		}
+		fv, ok := jsonField(doc, field)
+		if !ok {
+			continue
+		}
+		// copy the field into result, creating the intermediate objects
+		names := strings.Split(field, ".")
+		obj := result
+		for _, name := range names[:len(names)-1] {
+			sub, ok := obj[name].(map[string]interface{})
+			if !ok {
+				sub = make(map[string]interface{})
+				obj[name] = sub
+			}
+			obj = sub
+		}
+		obj[names[len(names)-1]] = fv
+	}
+
+	buf, err := json.Marshal(result)
+	if err != nil {
+		return nil, &ZError{Msg: "Cannot apply fragment to value of " + path.ToString(), Code: 0, Cause: err}
+	}
+	if _, ok := v.(*JSONValue); ok {
+		return &JSONValue{buf}, nil
+	}
+	return &StringValue{string(buf)}, nil
+}
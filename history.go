@@ -0,0 +1,248 @@
+/*
+ * Copyright (c) 2017, 2020 ADLINK Technology Inc.
+ *
+ * This program and the accompanying materials are made available under the
+ * terms of the Eclipse Public License 2.0 which is available at
+ * http://www.eclipse.org/legal/epl-2.0, or the Apache License, Version 2.0
+ * which is available at https://www.apache.org/licenses/LICENSE-2.0.
+ *
+ * SPDX-License-Identifier: EPL-2.0 OR Apache-2.0
+ *
+ * Contributors:
+ *   ADLINK zenoh team, <zenoh@adlink-labs.tech>
+ */
+
+package zenoh
+
+import (
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	zcore "github.com/eclipse-zenoh/zenoh-go/core"
+)
+
+// HistoryLimits bounds the samples kept for each path by a HistoryBackend.
+// The latest sample of a path is always kept.
+type HistoryLimits struct {
+	// MaxSamples is the maximum number of samples kept per path. If 0, there is no limit.
+	MaxSamples int
+
+	// MaxAge is the maximum age of the samples (according to their Timestamp). If 0, there is no limit.
+	MaxAge time.Duration
+
+	// MaxBytes is the maximum size of the values of the samples kept per path. If 0, there is no limit.
+	MaxBytes int64
+}
+
+// HistoryOptions configures a HistoryBackend (see NewHistoryBackend()).
+type HistoryOptions struct {
+	// Limits are the limits applied to the paths not matching any of the PrefixLimits.
+	Limits HistoryLimits
+
+	// PrefixLimits are the limits applied to the paths under a prefix (absolute Path).
+	// For a path under several prefixes, the limits of the longest prefix apply.
+	PrefixLimits map[string]HistoryLimits
+}
+
+// HistoryBackend is an in-memory StorageBackend keeping all the samples (i.e. the values
+// with their Timestamp) of each path, up to configurable limits.
+//
+// It answers the queries with a time range (i.e. with the "starttime" and/or "stoptime"
+// properties, see Workspace.GetRange()) with all the samples within the range, and the
+// other queries with the latest sample of each path. A removed path keeps its history,
+// but has no latest sample.
+type HistoryBackend struct {
+	opts HistoryOptions
+
+	mu     *sync.RWMutex
+	series map[Path]*historySeries
+}
+
+// historySeries are the samples of a path, sorted by Timestamp.
+type historySeries struct {
+	samples []historySample
+	bytes   int64
+}
+
+// historySample is a value with its Timestamp. The value is nil for a REMOVE.
+type historySample struct {
+	value Value
+	ts    Timestamp
+	size  int64
+}
+
+// NewHistoryBackend returns a new HistoryBackend.
+// If opts is nil, the default HistoryOptions are used (i.e. no limits).
+func NewHistoryBackend(opts *HistoryOptions) *HistoryBackend {
+	b := &HistoryBackend{mu: new(sync.RWMutex), series: make(map[Path]*historySeries)}
+	if opts != nil {
+		b.opts = *opts
+	}
+	return b
+}
+
+// limitsFor returns the limits applying to the Path p.
+func (b *HistoryBackend) limitsFor(p *Path) HistoryLimits {
+	limits := b.opts.Limits
+	longest := -1
+	for prefix, l := range b.opts.PrefixLimits {
+		prefix = strings.TrimSuffix(prefix, "/")
+		if (p.path == prefix || strings.HasPrefix(p.path, prefix+"/")) && len(prefix) > longest {
+			limits, longest = l, len(prefix)
+		}
+	}
+	return limits
+}
+
+// Put adds a sample to the history of the path.
+func (b *HistoryBackend) Put(path *Path, value Value, ts *Timestamp) error {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	b.add(path, value, ts)
+	return nil
+}
+
+// Update adds a sample to the history of the path. For JSON values, the value is applied
+// as a JSON merge patch to the value of the previous sample.
+func (b *HistoryBackend) Update(path *Path, value Value, ts *Timestamp) error {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	var last Value
+	if hs, ok := b.series[*path]; ok {
+		i := sort.Search(len(hs.samples), func(i int) bool { return !hs.samples[i].ts.Before(ts) })
+		if i > 0 {
+			last = hs.samples[i-1].value
+		}
+	}
+	merged, err := mergeUpdate(last, value)
+	if err != nil {
+		return &ZError{Msg: "Update of " + path.ToString() + " failed", Code: 0, Cause: err}
+	}
+	b.add(path, merged, ts)
+	return nil
+}
+
+// Remove adds a removal to the history of the path.
+func (b *HistoryBackend) Remove(path *Path, ts *Timestamp) error {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	b.add(path, nil, ts)
+	return nil
+}
+
+// add inserts a sample in the history of a path, and applies the limits.
+// b.mu must be locked by the caller.
+func (b *HistoryBackend) add(path *Path, value Value, ts *Timestamp) {
+	hs, ok := b.series[*path]
+	if !ok {
+		hs = new(historySeries)
+		b.series[*path] = hs
+	}
+	i := sort.Search(len(hs.samples), func(i int) bool { return !hs.samples[i].ts.Before(ts) })
+	if i < len(hs.samples) && !ts.Before(&hs.samples[i].ts) {
+		// same Timestamp: already added
+		return
+	}
+	sample := historySample{value: value, ts: *ts}
+	if value != nil {
+		sample.size = int64(len(value.Encode()))
+	}
+	hs.samples = append(hs.samples, historySample{})
+	copy(hs.samples[i+1:], hs.samples[i:])
+	hs.samples[i] = sample
+	hs.bytes += sample.size
+	b.prune(hs, b.limitsFor(path), time.Now())
+}
+
+// EvictSamples drops the samples of the path with a Timestamp before the time before (if not zero),
+// and the oldest samples exceeding maxSamples (if greater than 0). The latest sample is always kept.
+// It returns the number of dropped samples.
+func (b *HistoryBackend) EvictSamples(path *Path, before time.Time, maxSamples int) (int, error) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	hs, ok := b.series[*path]
+	if !ok {
+		return 0, nil
+	}
+	n := len(hs.samples)
+	now := time.Now()
+	limits := HistoryLimits{MaxSamples: maxSamples}
+	if !before.IsZero() {
+		limits.MaxAge = now.Sub(before)
+	}
+	b.prune(hs, limits, now)
+	return n - len(hs.samples), nil
+}
+
+// SampledPaths returns the paths having samples, including the removed ones.
+func (b *HistoryBackend) SampledPaths() ([]*Path, error) {
+	b.mu.RLock()
+	defer b.mu.RUnlock()
+	result := make([]*Path, 0, len(b.series))
+	for p, hs := range b.series {
+		if len(hs.samples) > 0 {
+			p := p
+			result = append(result, &p)
+		}
+	}
+	return result, nil
+}
+
+// prune drops the oldest samples exceeding the limits, always keeping the latest one.
+func (b *HistoryBackend) prune(hs *historySeries, limits HistoryLimits, now time.Time) {
+	drop := 0
+	for drop < len(hs.samples)-1 {
+		s := &hs.samples[drop]
+		count := len(hs.samples) - drop
+		if (limits.MaxSamples > 0 && count > limits.MaxSamples) ||
+			(limits.MaxBytes > 0 && hs.bytes > limits.MaxBytes) ||
+			(limits.MaxAge > 0 && now.Sub(s.ts.GoTime()) > limits.MaxAge) {
+			hs.bytes -= s.size
+			drop++
+			continue
+		}
+		break
+	}
+	if drop > 0 {
+		hs.samples = append(hs.samples[:0], hs.samples[drop:]...)
+	}
+}
+
+// Query returns the samples matching the path expression of the Selector s: all the samples
+// within the time range if s has one, or the latest sample of each path otherwise.
+func (b *HistoryBackend) Query(s *Selector) ([]StoredData, error) {
+	now := time.Now()
+	from, to, isRange, err := timeRangeOf(s, now)
+	if err != nil {
+		return nil, err
+	}
+	b.mu.RLock()
+	defer b.mu.RUnlock()
+	result := make([]StoredData, 0)
+	match := rnameMatcher(s.Path())
+	for p, hs := range b.series {
+		p := p
+		if len(hs.samples) == 0 || !match(&p) {
+			continue
+		}
+		if !isRange {
+			if latest := hs.samples[len(hs.samples)-1]; latest.value != nil {
+				result = append(result, StoredData{&p, latest.value, zcore.NewTimestamp(latest.ts.Time(), latest.ts.ClockID())})
+			}
+			continue
+		}
+		maxAge := b.limitsFor(&p).MaxAge
+		for i, sample := range hs.samples {
+			t := sample.ts.GoTime()
+			if sample.value == nil ||
+				(!from.IsZero() && t.Before(from)) || (!to.IsZero() && t.After(to)) ||
+				(maxAge > 0 && now.Sub(t) > maxAge && i < len(hs.samples)-1) {
+				continue
+			}
+			result = append(result, StoredData{&p, sample.value, zcore.NewTimestamp(sample.ts.Time(), sample.ts.ClockID())})
+		}
+	}
+	return result, nil
+}
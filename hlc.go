@@ -0,0 +1,63 @@
+/*
+ * Copyright (c) 2017, 2020 ADLINK Technology Inc.
+ *
+ * This program and the accompanying materials are made available under the
+ * terms of the Eclipse Public License 2.0 which is available at
+ * http://www.eclipse.org/legal/epl-2.0, or the Apache License, Version 2.0
+ * which is available at https://www.apache.org/licenses/LICENSE-2.0.
+ *
+ * SPDX-License-Identifier: EPL-2.0 OR Apache-2.0
+ *
+ * Contributors:
+ *   ADLINK zenoh team, <zenoh@adlink-labs.tech>
+ */
+
+package zenoh
+
+import (
+	"sync"
+	"time"
+
+	zcore "github.com/eclipse-zenoh/zenoh-go/core"
+)
+
+// hlc is a Hybrid Logical Clock, generating Timestamps close to the physical time,
+// but greater than all the Timestamps it generated or received before.
+type hlc struct {
+	mu   *sync.Mutex
+	last uint64
+	id   [16]byte
+}
+
+// newHLC returns a new hlc, with id (truncated to 16 bytes) as clock id of its Timestamps.
+func newHLC(id []byte) *hlc {
+	c := &hlc{mu: new(sync.Mutex)}
+	copy(c.id[:], id)
+	return c
+}
+
+// ntp64 returns the time t in the format of Timestamp.Time().
+func ntp64(t time.Time) uint64 {
+	return uint64(t.Unix())<<32 | (uint64(t.Nanosecond())<<32)/uint64(time.Second)
+}
+
+// newTimestamp returns a new Timestamp, greater than the ones generated or received before.
+func (c *hlc) newTimestamp() *Timestamp {
+	t := ntp64(time.Now())
+	c.mu.Lock()
+	if t <= c.last {
+		t = c.last + 1
+	}
+	c.last = t
+	c.mu.Unlock()
+	return zcore.NewTimestamp(t, c.id)
+}
+
+// update makes the next Timestamps greater than the received Timestamp ts.
+func (c *hlc) update(ts *Timestamp) {
+	c.mu.Lock()
+	if t := ts.Time(); t > c.last {
+		c.last = t
+	}
+	c.mu.Unlock()
+}
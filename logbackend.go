@@ -0,0 +1,626 @@
+/*
+ * Copyright (c) 2017, 2020 ADLINK Technology Inc.
+ *
+ * This program and the accompanying materials are made available under the
+ * terms of the Eclipse Public License 2.0 which is available at
+ * http://www.eclipse.org/legal/epl-2.0, or the Apache License, Version 2.0
+ * which is available at https://www.apache.org/licenses/LICENSE-2.0.
+ *
+ * SPDX-License-Identifier: EPL-2.0 OR Apache-2.0
+ *
+ * Contributors:
+ *   ADLINK zenoh team, <zenoh@adlink-labs.tech>
+ */
+
+package zenoh
+
+import (
+	"encoding/binary"
+	"fmt"
+	"hash/crc32"
+	"io"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	zcore "github.com/eclipse-zenoh/zenoh-go/core"
+	log "github.com/sirupsen/logrus"
+)
+
+// Default values for LogBackendOptions
+const (
+	defaultSegmentSize         = 64 * 1024 * 1024
+	defaultCompactionInterval  = time.Minute
+	defaultCompactionThreshold = 0.5
+	defaultTombstoneRetention  = 24 * time.Hour
+)
+
+const (
+	segmentSuffix = ".seg"
+	// size of a record's header: length and CRC32 of its body
+	recordHeaderSize = 8
+	// size of the fixed part of a record's body: kind, encoding, time and clock id of its Timestamp
+	recordFixedSize = 1 + 1 + 8 + 16
+)
+
+// LogBackendOptions configures a LogBackend (see NewLogBackend()).
+type LogBackendOptions struct {
+	// SegmentSize is the size above which the segment being written is sealed and a new one created.
+	// If 0, a default size of 64 MiB is used.
+	SegmentSize int64
+
+	// CompactionInterval is the interval between two background compactions.
+	// If 0, a default interval of 1 minute is used. If negative, there is no background compaction.
+	CompactionInterval time.Duration
+
+	// CompactionThreshold is the ratio of obsolete records above which a sealed segment is compacted.
+	// If 0, a default ratio of 0.5 is used.
+	CompactionThreshold float64
+
+	// TombstoneRetention is the duration during which the REMOVE records are kept, to drop
+	// the older changes received afterwards. If 0, a default duration of 24 hours is used.
+	TombstoneRetention time.Duration
+
+	// SyncWrites makes each write synced to the disk before returning.
+	SyncWrites bool
+}
+
+// LogBackend is a durable StorageBackend, writing the PUT, UPDATE and REMOVE records with their
+// Timestamps to an append-only log made of segment files in a directory.
+//
+// The index of the latest record for each path is kept in memory, and rebuilt from the segments
+// when the LogBackend is created. The values are read from the segments on queries.
+// The sealed segments with too many obsolete records are compacted in the background, their
+// remaining records being copied to the segment being written.
+type LogBackend struct {
+	dir  string
+	opts LogBackendOptions
+
+	mu        *sync.Mutex
+	compactMu *sync.Mutex // serializes the compactions, and the closing of the segments
+	segments  map[uint64]*logSegment
+	active    *logSegment
+	index     map[Path]*logEntry
+	closed    bool
+
+	stop chan struct{}
+	done chan struct{}
+}
+
+// logSegment is a segment file of a LogBackend.
+type logSegment struct {
+	id   uint64
+	f    *os.File
+	size int64
+	live int64 // size of the records referenced by the index
+}
+
+// logEntry locates the latest record of a path.
+type logEntry struct {
+	seg     uint64
+	off     int64
+	size    int64
+	ts      Timestamp
+	removed bool
+}
+
+// logRecord is a decoded record of a LogBackend.
+type logRecord struct {
+	kind     ChangeKind
+	encoding Encoding
+	ts       Timestamp
+	path     string
+	payload  []byte
+}
+
+// NewLogBackend opens (or creates) the LogBackend in directory dir, rebuilding its index.
+// If opts is nil, the default LogBackendOptions are used.
+// The LogBackend must be closed when no longer used.
+func NewLogBackend(dir string, opts *LogBackendOptions) (*LogBackend, error) {
+	b := &LogBackend{dir: dir, mu: new(sync.Mutex), compactMu: new(sync.Mutex), segments: make(map[uint64]*logSegment),
+		index: make(map[Path]*logEntry), stop: make(chan struct{}), done: make(chan struct{})}
+	if opts != nil {
+		b.opts = *opts
+	}
+	if b.opts.SegmentSize <= 0 {
+		b.opts.SegmentSize = defaultSegmentSize
+	}
+	if b.opts.CompactionInterval == 0 {
+		b.opts.CompactionInterval = defaultCompactionInterval
+	}
+	if b.opts.CompactionThreshold <= 0 {
+		b.opts.CompactionThreshold = defaultCompactionThreshold
+	}
+	if b.opts.TombstoneRetention <= 0 {
+		b.opts.TombstoneRetention = defaultTombstoneRetention
+	}
+
+	if err := os.MkdirAll(dir, 0755); err != nil {
+		return nil, &ZError{Msg: "Failed to create LogBackend directory " + dir, Code: 0, Cause: err}
+	}
+	if err := b.load(); err != nil {
+		b.closeFiles()
+		return nil, err
+	}
+
+	if b.opts.CompactionInterval > 0 {
+		go b.compactLoop()
+	} else {
+		close(b.done)
+	}
+	return b, nil
+}
+
+// load opens the existing segments in order, and rebuilds the index from their records.
+func (b *LogBackend) load() error {
+	files, err := ioutil.ReadDir(b.dir)
+	if err != nil {
+		return &ZError{Msg: "Failed to read LogBackend directory " + b.dir, Code: 0, Cause: err}
+	}
+	ids := make([]uint64, 0)
+	for _, fi := range files {
+		name := fi.Name()
+		if !strings.HasSuffix(name, segmentSuffix) {
+			continue
+		}
+		id, err := strconv.ParseUint(strings.TrimSuffix(name, segmentSuffix), 16, 64)
+		if err != nil {
+			continue
+		}
+		ids = append(ids, id)
+	}
+	sort.Slice(ids, func(i, j int) bool { return ids[i] < ids[j] })
+
+	for _, id := range ids {
+		seg, err := b.openSegment(id)
+		if err != nil {
+			return err
+		}
+		if err := b.scanSegment(seg); err != nil {
+			return err
+		}
+		b.active = seg
+	}
+	if b.active == nil || b.active.size >= b.opts.SegmentSize {
+		return b.rotate()
+	}
+	return nil
+}
+
+func (b *LogBackend) segmentPath(id uint64) string {
+	return filepath.Join(b.dir, fmt.Sprintf("%016x%s", id, segmentSuffix))
+}
+
+func (b *LogBackend) openSegment(id uint64) (*logSegment, error) {
+	f, err := os.OpenFile(b.segmentPath(id), os.O_RDWR|os.O_CREATE, 0644)
+	if err != nil {
+		return nil, &ZError{Msg: "Failed to open LogBackend segment " + b.segmentPath(id), Code: 0, Cause: err}
+	}
+	seg := &logSegment{id: id, f: f}
+	b.segments[id] = seg
+	return seg, nil
+}
+
+// scanSegment indexes the records of a segment. The segment is truncated at its first invalid
+// record (e.g. partially written before a crash).
+func (b *LogBackend) scanSegment(seg *logSegment) error {
+	fi, err := seg.f.Stat()
+	if err != nil {
+		return &ZError{Msg: "Failed to read LogBackend segment " + seg.f.Name(), Code: 0, Cause: err}
+	}
+	var off int64
+	header := make([]byte, recordHeaderSize)
+	for off < fi.Size() {
+		if _, err := seg.f.ReadAt(header, off); err != nil {
+			break
+		}
+		size := recordHeaderSize + int64(binary.BigEndian.Uint32(header))
+		if off+size > fi.Size() {
+			break
+		}
+		buf := make([]byte, size)
+		if _, err := seg.f.ReadAt(buf, off); err != nil {
+			break
+		}
+		rec, err := decodeLogRecord(buf)
+		if err != nil {
+			break
+		}
+		seg.size = off + size
+		if p, err := NewPath(rec.path); err == nil {
+			b.indexRecord(p, &logEntry{seg.id, off, size, rec.ts, rec.kind == REMOVE})
+		}
+		off += size
+	}
+	if off < fi.Size() {
+		logger.WithFields(log.Fields{
+			"segment": seg.f.Name(),
+			"offset":  off,
+		}).Warn("LogBackend : truncating segment at invalid record")
+		if err := seg.f.Truncate(off); err != nil {
+			return &ZError{Msg: "Failed to truncate LogBackend segment " + seg.f.Name(), Code: 0, Cause: err}
+		}
+	}
+	seg.size = off
+	return nil
+}
+
+// indexRecord makes e the latest record of path p, unless the indexed one is more recent.
+func (b *LogBackend) indexRecord(p *Path, e *logEntry) {
+	if old, ok := b.index[*p]; ok {
+		if e.ts.Before(&old.ts) {
+			return
+		}
+		b.segments[old.seg].live -= old.size
+	}
+	b.index[*p] = e
+	b.segments[e.seg].live += e.size
+}
+
+// rotate seals the active segment (if any) and creates a new one.
+func (b *LogBackend) rotate() error {
+	var id uint64 = 1
+	if b.active != nil {
+		if err := b.active.f.Sync(); err != nil {
+			return &ZError{Msg: "Failed to sync LogBackend segment " + b.active.f.Name(), Code: 0, Cause: err}
+		}
+		id = b.active.id + 1
+	}
+	seg, err := b.openSegment(id)
+	if err != nil {
+		return err
+	}
+	b.active = seg
+	return nil
+}
+
+// append writes a record to the active segment and returns its location.
+func (b *LogBackend) append(rec []byte) (uint64, int64, error) {
+	if b.active.size > 0 && b.active.size+int64(len(rec)) > b.opts.SegmentSize {
+		if err := b.rotate(); err != nil {
+			return 0, 0, err
+		}
+	}
+	seg := b.active
+	if _, err := seg.f.WriteAt(rec, seg.size); err != nil {
+		// drop the partially written record, if any
+		seg.f.Truncate(seg.size)
+		return 0, 0, &ZError{Msg: "Failed to write LogBackend segment " + seg.f.Name(), Code: 0, Cause: err}
+	}
+	if b.opts.SyncWrites {
+		if err := seg.f.Sync(); err != nil {
+			return 0, 0, &ZError{Msg: "Failed to sync LogBackend segment " + seg.f.Name(), Code: 0, Cause: err}
+		}
+	}
+	off := seg.size
+	seg.size += int64(len(rec))
+	return seg.id, off, nil
+}
+
+// readRecord reads the record located by e.
+func (b *LogBackend) readRecord(e *logEntry) ([]byte, *logRecord, error) {
+	return readSegmentRecord(b.segments[e.seg], e)
+}
+
+// readSegmentRecord reads the record located by e in seg.
+func readSegmentRecord(seg *logSegment, e *logEntry) ([]byte, *logRecord, error) {
+	buf := make([]byte, e.size)
+	if _, err := seg.f.ReadAt(buf, e.off); err != nil && err != io.EOF {
+		return nil, nil, &ZError{Msg: "Failed to read LogBackend segment " + seg.f.Name(), Code: 0, Cause: err}
+	}
+	rec, err := decodeLogRecord(buf)
+	if err != nil {
+		return nil, nil, &ZError{Msg: "Invalid record in LogBackend segment " + seg.f.Name(), Code: 0, Cause: err}
+	}
+	return buf, rec, nil
+}
+
+// readValue returns the value of the record located by e.
+func (b *LogBackend) readValue(e *logEntry) (Value, error) {
+	_, rec, err := b.readRecord(e)
+	if err != nil {
+		return nil, err
+	}
+	decoder, ok := valueDecoders[rec.encoding]
+	if !ok {
+		return nil, &ZError{Msg: "No Decoder found for encoding " + strconv.Itoa(int(rec.encoding)) + " of " + rec.path, Code: 0, Cause: nil}
+	}
+	return decoder(rec.payload)
+}
+
+// Put stores the value for the path, unless a more recent change has been stored.
+func (b *LogBackend) Put(path *Path, value Value, ts *Timestamp) error {
+	return b.write(PUT, path, value, ts)
+}
+
+// Update updates the value of the path, unless a more recent change has been stored.
+// For JSON values, the value is applied as a JSON merge patch to the stored value.
+func (b *LogBackend) Update(path *Path, value Value, ts *Timestamp) error {
+	return b.write(UPDATE, path, value, ts)
+}
+
+// Remove removes the value of the path, unless a more recent change has been stored.
+func (b *LogBackend) Remove(path *Path, ts *Timestamp) error {
+	return b.write(REMOVE, path, nil, ts)
+}
+
+func (b *LogBackend) write(kind ChangeKind, path *Path, value Value, ts *Timestamp) error {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	if b.closed {
+		return &ZError{Msg: "LogBackend " + b.dir + " is closed", Code: 0, Cause: nil}
+	}
+	old, ok := b.index[*path]
+	if ok && !old.ts.Before(ts) {
+		return nil
+	}
+	if kind == UPDATE {
+		// store the full value resulting from the update
+		var last Value
+		if ok && !old.removed {
+			v, err := b.readValue(old)
+			if err != nil {
+				return err
+			}
+			last = v
+		}
+		merged, err := mergeUpdate(last, value)
+		if err != nil {
+			return &ZError{Msg: "Update of " + path.ToString() + " failed", Code: 0, Cause: err}
+		}
+		value = merged
+	}
+
+	rec := &logRecord{kind: kind, ts: *ts, path: path.ToString()}
+	if value != nil {
+		rec.encoding = value.Encoding()
+		rec.payload = value.Encode()
+	}
+	buf := encodeLogRecord(rec)
+	seg, off, err := b.append(buf)
+	if err != nil {
+		return err
+	}
+	b.indexRecord(path, &logEntry{seg, off, int64(len(buf)), *ts, kind == REMOVE})
+	return nil
+}
+
+// Query returns the stored path/values matching the path expression of the Selector s.
+func (b *LogBackend) Query(s *Selector) ([]StoredData, error) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	if b.closed {
+		return nil, &ZError{Msg: "LogBackend " + b.dir + " is closed", Code: 0, Cause: nil}
+	}
+	result := make([]StoredData, 0)
+	match := rnameMatcher(s.Path())
+	for p, e := range b.index {
+		p := p
+		if e.removed || !match(&p) {
+			continue
+		}
+		v, err := b.readValue(e)
+		if err != nil {
+			return nil, err
+		}
+		result = append(result, StoredData{&p, v, zcore.NewTimestamp(e.ts.Time(), e.ts.ClockID())})
+	}
+	return result, nil
+}
+
+// Compact compacts the sealed segments having a ratio of obsolete records above
+// the CompactionThreshold. It's periodically called in background, unless
+// the CompactionInterval is negative.
+//
+// The records are read and copied without blocking the writes and queries,
+// except while the copies are appended to the segment being written.
+func (b *LogBackend) Compact() error {
+	b.compactMu.Lock()
+	defer b.compactMu.Unlock()
+	b.mu.Lock()
+	if b.closed {
+		b.mu.Unlock()
+		return &ZError{Msg: "LogBackend " + b.dir + " is closed", Code: 0, Cause: nil}
+	}
+	ids := make([]uint64, 0, len(b.segments))
+	for id := range b.segments {
+		if id != b.active.id {
+			ids = append(ids, id)
+		}
+	}
+	sort.Slice(ids, func(i, j int) bool { return ids[i] < ids[j] })
+
+	// the tombstones can be dropped only from the oldest segment,
+	// otherwise the removed records of the older segments would be indexed again at restart
+	segs := make([]*logSegment, 0)
+	oldest := make([]bool, 0)
+	allCompacted := true
+	for _, id := range ids {
+		seg := b.segments[id]
+		if float64(seg.size-seg.live) < b.opts.CompactionThreshold*float64(seg.size) {
+			allCompacted = false
+			continue
+		}
+		segs = append(segs, seg)
+		oldest = append(oldest, allCompacted)
+	}
+	b.mu.Unlock()
+
+	for i, seg := range segs {
+		if err := b.compactSegment(seg, oldest[i]); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// compactSegment copies the indexed records of a sealed segment to the active segment,
+// and deletes the segment. It's called with b.compactMu locked.
+func (b *LogBackend) compactSegment(seg *logSegment, dropTombstones bool) error {
+	logger.WithField("segment", seg.f.Name()).Debug("LogBackend : compacting segment")
+	b.mu.Lock()
+	entries := make(map[Path]logEntry)
+	for p, e := range b.index {
+		if e.seg != seg.id {
+			continue
+		}
+		if e.removed && dropTombstones && time.Since(e.ts.GoTime()) > b.opts.TombstoneRetention {
+			delete(b.index, p)
+			seg.live -= e.size
+			continue
+		}
+		entries[p] = *e
+	}
+	b.mu.Unlock()
+
+	// the segment is sealed: its records can be read without the lock
+	copies := make([]byte, 0)
+	offsets := make(map[Path]int64, len(entries))
+	for p, e := range entries {
+		e := e
+		buf, _, err := readSegmentRecord(seg, &e)
+		if err != nil {
+			return err
+		}
+		offsets[p] = int64(len(copies))
+		copies = append(copies, buf...)
+	}
+
+	b.mu.Lock()
+	if b.closed {
+		b.mu.Unlock()
+		return &ZError{Msg: "LogBackend " + b.dir + " is closed", Code: 0, Cause: nil}
+	}
+	active := b.active
+	if len(copies) > 0 {
+		id, off, err := b.append(copies)
+		if err != nil {
+			b.mu.Unlock()
+			return err
+		}
+		active = b.segments[id]
+		for p, e := range entries {
+			// the records overwritten since they were read are not indexed anymore
+			if cur, ok := b.index[p]; ok && cur.seg == seg.id && cur.off == e.off {
+				seg.live -= cur.size
+				cur.seg, cur.off = id, off+offsets[p]
+				active.live += cur.size
+			}
+		}
+	}
+	delete(b.segments, seg.id)
+	b.mu.Unlock()
+
+	// make sure the copies are on disk before deleting the segment
+	if err := active.f.Sync(); err != nil {
+		return &ZError{Msg: "Failed to sync LogBackend segment " + active.f.Name(), Code: 0, Cause: err}
+	}
+	seg.f.Close()
+	if err := os.Remove(seg.f.Name()); err != nil {
+		return &ZError{Msg: "Failed to remove LogBackend segment " + seg.f.Name(), Code: 0, Cause: err}
+	}
+	return nil
+}
+
+func (b *LogBackend) compactLoop() {
+	defer close(b.done)
+	ticker := time.NewTicker(b.opts.CompactionInterval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ticker.C:
+			if err := b.Compact(); err != nil {
+				logger.WithFields(log.Fields{
+					"dir":   b.dir,
+					"error": err,
+				}).Warn("LogBackend compaction failed")
+			}
+		case <-b.stop:
+			return
+		}
+	}
+}
+
+// Close stops the background compaction, syncs the segment being written and closes the segments.
+func (b *LogBackend) Close() error {
+	b.mu.Lock()
+	if b.closed {
+		b.mu.Unlock()
+		return nil
+	}
+	b.closed = true
+	close(b.stop)
+	b.mu.Unlock()
+	<-b.done
+
+	b.compactMu.Lock()
+	defer b.compactMu.Unlock()
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	var err error
+	if e := b.active.f.Sync(); e != nil {
+		err = &ZError{Msg: "Failed to sync LogBackend segment " + b.active.f.Name(), Code: 0, Cause: e}
+	}
+	b.closeFiles()
+	return err
+}
+
+func (b *LogBackend) closeFiles() {
+	for _, seg := range b.segments {
+		seg.f.Close()
+	}
+}
+
+// encodeLogRecord returns a record: the length and CRC32 of its body, followed by its body
+// made of the kind, the encoding, the Timestamp, the length of the path, the path and the payload.
+func encodeLogRecord(rec *logRecord) []byte {
+	bodySize := recordFixedSize + binary.MaxVarintLen64 + len(rec.path) + len(rec.payload)
+	buf := make([]byte, recordHeaderSize+bodySize)
+	body := buf[recordHeaderSize:]
+	body[0] = rec.kind
+	body[1] = rec.encoding
+	binary.BigEndian.PutUint64(body[2:], rec.ts.Time())
+	clk := rec.ts.ClockID()
+	copy(body[10:], clk[:])
+	n := recordFixedSize
+	n += binary.PutUvarint(body[n:], uint64(len(rec.path)))
+	n += copy(body[n:], rec.path)
+	n += copy(body[n:], rec.payload)
+	body = body[:n]
+	binary.BigEndian.PutUint32(buf[0:], uint32(n))
+	binary.BigEndian.PutUint32(buf[4:], crc32.ChecksumIEEE(body))
+	return buf[:recordHeaderSize+n]
+}
+
+// decodeLogRecord decodes a record, checking its length and CRC32.
+func decodeLogRecord(buf []byte) (*logRecord, error) {
+	if len(buf) < recordHeaderSize+recordFixedSize {
+		return nil, &ZError{Msg: "Truncated record", Code: 0, Cause: nil}
+	}
+	body := buf[recordHeaderSize:]
+	if int(binary.BigEndian.Uint32(buf[0:])) != len(body) {
+		return nil, &ZError{Msg: "Invalid record length", Code: 0, Cause: nil}
+	}
+	if binary.BigEndian.Uint32(buf[4:]) != crc32.ChecksumIEEE(body) {
+		return nil, &ZError{Msg: "Invalid record checksum", Code: 0, Cause: nil}
+	}
+	var clk [16]byte
+	copy(clk[:], body[10:recordFixedSize])
+	pathLen, n := binary.Uvarint(body[recordFixedSize:])
+	if n <= 0 || uint64(len(body)-recordFixedSize-n) < pathLen {
+		return nil, &ZError{Msg: "Invalid record path", Code: 0, Cause: nil}
+	}
+	start := recordFixedSize + n
+	return &logRecord{
+		kind:     body[0],
+		encoding: body[1],
+		ts:       *zcore.NewTimestamp(binary.BigEndian.Uint64(body[2:]), clk),
+		path:     string(body[start : start+int(pathLen)]),
+		payload:  body[start+int(pathLen):],
+	}, nil
+}
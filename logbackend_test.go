@@ -0,0 +1,238 @@
+/*
+ * Copyright (c) 2017, 2020 ADLINK Technology Inc.
+ *
+ * This program and the accompanying materials are made available under the
+ * terms of the Eclipse Public License 2.0 which is available at
+ * http://www.eclipse.org/legal/epl-2.0, or the Apache License, Version 2.0
+ * which is available at https://www.apache.org/licenses/LICENSE-2.0.
+ *
+ * SPDX-License-Identifier: EPL-2.0 OR Apache-2.0
+ *
+ * Contributors:
+ *   ADLINK zenoh team, <zenoh@adlink-labs.tech>
+ */
+
+package zenoh
+
+import (
+	"bytes"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+// newTestLogBackend returns a LogBackend in a new temporary directory, without background compaction.
+func newTestLogBackend(t *testing.T, opts LogBackendOptions) (*LogBackend, string) {
+	dir, err := ioutil.TempDir("", "zenoh-logbackend")
+	if err != nil {
+		t.Fatal(err)
+	}
+	opts.CompactionInterval = -1
+	b, err := NewLogBackend(dir, &opts)
+	if err != nil {
+		os.RemoveAll(dir)
+		t.Fatal(err)
+	}
+	return b, dir
+}
+
+// recentTimestamps returns a function returning the Timestamp of the current time plus n fractions of second,
+// the current time being the same for all calls.
+func recentTimestamps() func(n uint64) *Timestamp {
+	now := uint64(time.Now().Unix()) << 32
+	return func(n uint64) *Timestamp {
+		return testTimestamp(now + n)
+	}
+}
+
+// queryPaths returns the values of the paths matching selector, by path.
+func queryPaths(t *testing.T, b StorageBackend, selector string) map[string]string {
+	s, _ := NewSelector(selector)
+	data, err := b.Query(s)
+	if err != nil {
+		t.Fatalf("Query(%s) failed: %v", selector, err)
+	}
+	result := make(map[string]string)
+	for _, d := range data {
+		result[d.Path.ToString()] = d.Value.ToString()
+	}
+	return result
+}
+
+func TestLogRecordEncoding(t *testing.T) {
+	rec := &logRecord{kind: UPDATE, encoding: STRING, ts: *testTimestamp(42), path: "/a/b", payload: []byte("value")}
+	buf := encodeLogRecord(rec)
+	dec, err := decodeLogRecord(buf)
+	if err != nil {
+		t.Fatalf("decodeLogRecord() failed: %v", err)
+	}
+	if dec.kind != rec.kind || dec.encoding != rec.encoding || dec.ts.Time() != 42 || dec.ts.ClockID() != rec.ts.ClockID() ||
+		dec.path != rec.path || !bytes.Equal(dec.payload, rec.payload) {
+		t.Errorf("decodeLogRecord() = %+v, expected %+v", dec, rec)
+	}
+
+	empty := encodeLogRecord(&logRecord{kind: REMOVE, ts: *testTimestamp(1), path: "/a"})
+	if dec, err := decodeLogRecord(empty); err != nil || dec.path != "/a" || len(dec.payload) != 0 {
+		t.Errorf("decodeLogRecord() of a REMOVE = %+v, %v", dec, err)
+	}
+
+	if _, err := decodeLogRecord(buf[:len(buf)-1]); err == nil {
+		t.Error("decodeLogRecord() of a truncated record succeeded")
+	}
+	if _, err := decodeLogRecord(buf[:recordHeaderSize]); err == nil {
+		t.Error("decodeLogRecord() of a record header succeeded")
+	}
+	corrupted := append([]byte{}, buf...)
+	corrupted[len(corrupted)-1] ^= 0xff
+	if _, err := decodeLogRecord(corrupted); err == nil {
+		t.Error("decodeLogRecord() of a corrupted record succeeded")
+	}
+}
+
+func TestLogBackendTruncatedTail(t *testing.T) {
+	b, dir := newTestLogBackend(t, LogBackendOptions{})
+	defer os.RemoveAll(dir)
+	a, _ := NewPath("/test/a")
+	c, _ := NewPath("/test/c")
+	b.Put(a, NewStringValue("1"), testTimestamp(1))
+	b.Put(c, NewStringValue("2"), testTimestamp(2))
+	seg := b.active.f.Name()
+	if err := b.Close(); err != nil {
+		t.Fatal(err)
+	}
+	info, _ := os.Stat(seg)
+
+	// a record partially written before a crash
+	partial := encodeLogRecord(&logRecord{kind: PUT, encoding: STRING, ts: *testTimestamp(3), path: "/test/a", payload: []byte("3")})
+	f, _ := os.OpenFile(seg, os.O_WRONLY|os.O_APPEND, 0644)
+	f.Write(partial[:len(partial)-2])
+	f.Close()
+
+	b, err := NewLogBackend(dir, &LogBackendOptions{CompactionInterval: -1})
+	if err != nil {
+		t.Fatalf("NewLogBackend() failed on a truncated segment: %v", err)
+	}
+	defer b.Close()
+	if fi, _ := os.Stat(seg); fi.Size() != info.Size() {
+		t.Errorf("segment size is %d, expected %d", fi.Size(), info.Size())
+	}
+	if values := queryPaths(t, b, "/test/**"); values["/test/a"] != "1" || values["/test/c"] != "2" {
+		t.Errorf("recovered values %v", values)
+	}
+	if err := b.Put(a, NewStringValue("4"), testTimestamp(4)); err != nil {
+		t.Fatalf("Put() after recovery failed: %v", err)
+	}
+	if values := queryPaths(t, b, "/test/a"); values["/test/a"] != "4" {
+		t.Errorf("value after recovery %v", values)
+	}
+}
+
+func TestLogBackendCompaction(t *testing.T) {
+	b, dir := newTestLogBackend(t, LogBackendOptions{SegmentSize: 256, TombstoneRetention: time.Hour})
+	defer os.RemoveAll(dir)
+	nowTimestamp := recentTimestamps()
+	a, _ := NewPath("/test/a")
+	c, _ := NewPath("/test/c")
+	b.Put(a, NewStringValue("a"), nowTimestamp(1))
+	b.Remove(a, nowTimestamp(2))
+	for i := uint64(0); i < 20; i++ {
+		b.Put(c, NewStringValue("c"), nowTimestamp(3+i))
+	}
+	before, _ := filepath.Glob(filepath.Join(dir, "*"+segmentSuffix))
+	if err := b.Compact(); err != nil {
+		t.Fatalf("Compact() failed: %v", err)
+	}
+	after, _ := filepath.Glob(filepath.Join(dir, "*"+segmentSuffix))
+	if len(after) >= len(before) {
+		t.Errorf("%d segments after compaction, %d before", len(after), len(before))
+	}
+	// the tombstone is retained: an older PUT is ignored
+	b.Put(a, NewStringValue("old"), nowTimestamp(0))
+	if values := queryPaths(t, b, "/test/**"); len(values) != 1 || values["/test/c"] != "c" {
+		t.Errorf("values after compaction %v", values)
+	}
+	b.Close()
+
+	b, err := NewLogBackend(dir, &LogBackendOptions{CompactionInterval: -1})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer b.Close()
+	if values := queryPaths(t, b, "/test/**"); len(values) != 1 || values["/test/c"] != "c" {
+		t.Errorf("values after restart %v", values)
+	}
+}
+
+func TestLogBackendCompactionDropsTombstones(t *testing.T) {
+	b, dir := newTestLogBackend(t, LogBackendOptions{SegmentSize: 256, TombstoneRetention: time.Nanosecond})
+	defer os.RemoveAll(dir)
+	nowTimestamp := recentTimestamps()
+	a, _ := NewPath("/test/a")
+	c, _ := NewPath("/test/c")
+	b.Put(a, NewStringValue("a"), nowTimestamp(1))
+	b.Remove(a, nowTimestamp(2))
+	for i := uint64(0); i < 20; i++ {
+		b.Put(c, NewStringValue("c"), nowTimestamp(3+i))
+	}
+	time.Sleep(time.Millisecond)
+	if err := b.Compact(); err != nil {
+		t.Fatalf("Compact() failed: %v", err)
+	}
+	b.mu.Lock()
+	_, indexed := b.index[*a]
+	b.mu.Unlock()
+	if indexed {
+		t.Error("expired tombstone still indexed after compaction")
+	}
+	b.Close()
+
+	b, err := NewLogBackend(dir, &LogBackendOptions{CompactionInterval: -1})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer b.Close()
+	if values := queryPaths(t, b, "/test/**"); len(values) != 1 || values["/test/c"] != "c" {
+		t.Errorf("values after restart %v", values)
+	}
+}
+
+func TestLogBackendCompactionConcurrentWrites(t *testing.T) {
+	b, dir := newTestLogBackend(t, LogBackendOptions{SegmentSize: 512})
+	defer os.RemoveAll(dir)
+	c, _ := NewPath("/test/c")
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		for i := uint64(1); i <= 500; i++ {
+			if err := b.Put(c, NewIntValue(int64(i)), testTimestamp(i)); err != nil {
+				t.Errorf("Put() failed: %v", err)
+				return
+			}
+		}
+	}()
+	for compacting := true; compacting; {
+		select {
+		case <-done:
+			compacting = false
+		default:
+		}
+		if err := b.Compact(); err != nil {
+			t.Fatalf("Compact() failed: %v", err)
+		}
+	}
+	if values := queryPaths(t, b, "/test/c"); values["/test/c"] != "500" {
+		t.Errorf("value after compactions %v", values)
+	}
+	b.Close()
+
+	b, err := NewLogBackend(dir, &LogBackendOptions{CompactionInterval: -1})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer b.Close()
+	if values := queryPaths(t, b, "/test/c"); values["/test/c"] != "500" {
+		t.Errorf("value after restart %v", values)
+	}
+}
@@ -0,0 +1,184 @@
+/*
+ * Copyright (c) 2017, 2020 ADLINK Technology Inc.
+ *
+ * This program and the accompanying materials are made available under the
+ * terms of the Eclipse Public License 2.0 which is available at
+ * http://www.eclipse.org/legal/epl-2.0, or the Apache License, Version 2.0
+ * which is available at https://www.apache.org/licenses/LICENSE-2.0.
+ *
+ * SPDX-License-Identifier: EPL-2.0 OR Apache-2.0
+ *
+ * Contributors:
+ *   ADLINK zenoh team, <zenoh@adlink-labs.tech>
+ */
+
+package zenoh
+
+import (
+	"bytes"
+	"encoding/json"
+	"reflect"
+	"sync"
+
+	log "github.com/sirupsen/logrus"
+)
+
+// ApplyMergePatch applies a JSON merge patch (as defined by RFC 7396) to a JSON value,
+// and returns the resulting JSON value.
+// target can be nil, in which case the patch is applied to an empty JSON object.
+func ApplyMergePatch(target Value, patch Value) (Value, error) {
+	p, err := decodeJSONValue(patch)
+	if err != nil {
+		return nil, &ZError{Msg: "Invalid JSON merge patch", Code: 0, Cause: err}
+	}
+	var t interface{}
+	if target != nil {
+		if t, err = decodeJSONValue(target); err != nil {
+			return nil, &ZError{Msg: "Invalid JSON merge patch target", Code: 0, Cause: err}
+		}
+	}
+	buf, err := json.Marshal(mergePatch(t, p))
+	if err != nil {
+		return nil, &ZError{Msg: "Failed to encode JSON merge patch result", Code: 0, Cause: err}
+	}
+	return &JSONValue{buf}, nil
+}
+
+// CreateMergePatch returns the JSON merge patch (as defined by RFC 7396) that transforms
+// the JSON value old into the JSON value new.
+//
+// Notice that a merge patch cannot set a field to null: the null fields of new are missing
+// from the result of the patch application.
+func CreateMergePatch(old Value, new Value) (Value, error) {
+	o, err := decodeJSONValue(old)
+	if err != nil {
+		return nil, &ZError{Msg: "Invalid old JSON value", Code: 0, Cause: err}
+	}
+	n, err := decodeJSONValue(new)
+	if err != nil {
+		return nil, &ZError{Msg: "Invalid new JSON value", Code: 0, Cause: err}
+	}
+	buf, err := json.Marshal(createMergePatch(o, n))
+	if err != nil {
+		return nil, &ZError{Msg: "Failed to encode JSON merge patch", Code: 0, Cause: err}
+	}
+	return &JSONValue{buf}, nil
+}
+
+// UpdateDiff computes the JSON merge patch transforming the JSON value old into
+// the JSON value new, and updates the path with this patch into Zenoh.
+func (w *Workspace) UpdateDiff(path *Path, old Value, new Value) error {
+	patch, err := CreateMergePatch(old, new)
+	if err != nil {
+		return &ZError{Msg: "UpdateDiff on " + path.ToString() + " failed", Code: 0, Cause: err}
+	}
+	return w.Update(path, patch)
+}
+
+// MergingListener returns a Listener that keeps the last full value of each path,
+// and calls listener with UPDATE changes having JSON values replaced with the result of
+// their application, as JSON merge patches, to the last full value of the path.
+//
+// If a JSON merge patch can't be applied, the UPDATE change is passed with its
+// original value and with an error (see Change.Err()).
+func MergingListener(listener Listener) Listener {
+	mu := new(sync.Mutex)
+	values := make(map[Path]Value)
+	return func(changes []Change) {
+		mu.Lock()
+		for i := range changes {
+			c := &changes[i]
+			switch c.kind {
+			case PUT:
+				values[*c.path] = c.value
+			case REMOVE:
+				delete(values, *c.path)
+			case UPDATE:
+				merged, err := mergeUpdate(values[*c.path], c.value)
+				if err != nil {
+					logger.WithFields(log.Fields{
+						"path":  c.path,
+						"error": err,
+					}).Warn("MergingListener failed to apply UPDATE")
+					c.err = err
+					continue
+				}
+				values[*c.path] = merged
+				c.value = merged
+			}
+		}
+		mu.Unlock()
+		listener(changes)
+	}
+}
+
+// mergeUpdate returns the result of an UPDATE's value applied to the last value of a path.
+// The values which are not JSON replace the last value.
+func mergeUpdate(last Value, update Value) (Value, error) {
+	if update == nil || update.Encoding() != JSON {
+		return update, nil
+	}
+	if last != nil && last.Encoding() != JSON {
+		last = nil
+	}
+	return ApplyMergePatch(last, update)
+}
+
+func decodeJSONValue(v Value) (interface{}, error) {
+	if v.Encoding() != JSON {
+		return nil, &ZError{Msg: "Value is not JSON", Code: 0, Cause: nil}
+	}
+	var doc interface{}
+	decoder := json.NewDecoder(bytes.NewReader(v.Encode()))
+	decoder.UseNumber()
+	if err := decoder.Decode(&doc); err != nil {
+		return nil, err
+	}
+	return doc, nil
+}
+
+// mergePatch applies the decoded JSON merge patch to the decoded JSON target
+// (possibly modifying it), as specified by RFC 7396.
+func mergePatch(target interface{}, patch interface{}) interface{} {
+	p, ok := patch.(map[string]interface{})
+	if !ok {
+		return patch
+	}
+	t, ok := target.(map[string]interface{})
+	if !ok {
+		t = make(map[string]interface{})
+	}
+	for k, v := range p {
+		if v == nil {
+			delete(t, k)
+		} else {
+			t[k] = mergePatch(t[k], v)
+		}
+	}
+	return t
+}
+
+// createMergePatch returns the decoded JSON merge patch transforming
+// the decoded JSON old into the decoded JSON new.
+func createMergePatch(old interface{}, new interface{}) interface{} {
+	o, ok1 := old.(map[string]interface{})
+	n, ok2 := new.(map[string]interface{})
+	if !ok1 || !ok2 {
+		return new
+	}
+	patch := make(map[string]interface{})
+	for k := range o {
+		if _, ok := n[k]; !ok {
+			patch[k] = nil
+		}
+	}
+	for k, nv := range n {
+		ov, ok := o[k]
+		if !ok {
+			patch[k] = nv
+		} else if !reflect.DeepEqual(ov, nv) {
+			patch[k] = createMergePatch(ov, nv)
+		}
+	}
+	return patch
+}
@@ -0,0 +1,110 @@
+/*
+ * Copyright (c) 2017, 2020 ADLINK Technology Inc.
+ *
+ * This program and the accompanying materials are made available under the
+ * terms of the Eclipse Public License 2.0 which is available at
+ * http://www.eclipse.org/legal/epl-2.0, or the Apache License, Version 2.0
+ * which is available at https://www.apache.org/licenses/LICENSE-2.0.
+ *
+ * SPDX-License-Identifier: EPL-2.0 OR Apache-2.0
+ *
+ * Contributors:
+ *   ADLINK zenoh team, <zenoh@adlink-labs.tech>
+ */
+
+package zenoh
+
+import (
+	"encoding/json"
+	"reflect"
+	"testing"
+)
+
+// jsonEqual returns true if the JSON value v is equal to the JSON document expected.
+func jsonEqual(t *testing.T, v Value, expected string) bool {
+	var d1, d2 interface{}
+	if err := json.Unmarshal(v.Encode(), &d1); err != nil {
+		t.Fatalf("invalid JSON %s: %v", v.ToString(), err)
+	}
+	if err := json.Unmarshal([]byte(expected), &d2); err != nil {
+		t.Fatalf("invalid JSON %s: %v", expected, err)
+	}
+	return reflect.DeepEqual(d1, d2)
+}
+
+// The test vectors of RFC 7396, appendix A.
+var mergePatchTests = []struct {
+	target, patch, result string
+}{
+	{`{"a":"b"}`, `{"a":"c"}`, `{"a":"c"}`},
+	{`{"a":"b"}`, `{"b":"c"}`, `{"a":"b","b":"c"}`},
+	{`{"a":"b"}`, `{"a":null}`, `{}`},
+	{`{"a":"b","b":"c"}`, `{"a":null}`, `{"b":"c"}`},
+	{`{"a":["b"]}`, `{"a":"c"}`, `{"a":"c"}`},
+	{`{"a":"c"}`, `{"a":["b"]}`, `{"a":["b"]}`},
+	{`{"a":{"b":"c"}}`, `{"a":{"b":"d","c":null}}`, `{"a":{"b":"d"}}`},
+	{`{"a":[{"b":"c"}]}`, `{"a":[1]}`, `{"a":[1]}`},
+	{`["a","b"]`, `["c","d"]`, `["c","d"]`},
+	{`{"a":"b"}`, `["c"]`, `["c"]`},
+	{`{"a":"foo"}`, `null`, `null`},
+	{`{"a":"foo"}`, `"bar"`, `"bar"`},
+	{`{"e":null}`, `{"a":1}`, `{"e":null,"a":1}`},
+	{`[1,2]`, `{"a":"b","c":null}`, `{"a":"b"}`},
+	{`{}`, `{"a":{"bb":{"ccc":null}}}`, `{"a":{"bb":{}}}`},
+}
+
+func TestApplyMergePatch(t *testing.T) {
+	for _, test := range mergePatchTests {
+		result, err := ApplyMergePatch(&JSONValue{[]byte(test.target)}, &JSONValue{[]byte(test.patch)})
+		if err != nil {
+			t.Errorf("ApplyMergePatch(%s, %s) failed: %v", test.target, test.patch, err)
+			continue
+		}
+		if !jsonEqual(t, result, test.result) {
+			t.Errorf("ApplyMergePatch(%s, %s) = %s, expected %s", test.target, test.patch, result.ToString(), test.result)
+		}
+	}
+}
+
+func TestApplyMergePatchErrors(t *testing.T) {
+	if _, err := ApplyMergePatch(nil, &JSONValue{[]byte(`{"a":1}`)}); err != nil {
+		t.Errorf("ApplyMergePatch(nil, patch) failed: %v", err)
+	}
+	if _, err := ApplyMergePatch(nil, NewIntValue(1)); err == nil {
+		t.Error("ApplyMergePatch() with a non JSON patch succeeded")
+	}
+	if _, err := ApplyMergePatch(&JSONValue{[]byte(`{`)}, &JSONValue{[]byte(`{}`)}); err == nil {
+		t.Error("ApplyMergePatch() with an invalid JSON target succeeded")
+	}
+}
+
+func TestCreateMergePatch(t *testing.T) {
+	tests := []struct {
+		old, new string
+	}{
+		{`{"a":"b"}`, `{"a":"c"}`},
+		{`{"a":"b"}`, `{"a":"b","b":"c"}`},
+		{`{"a":"b","b":"c"}`, `{"b":"c"}`},
+		{`{"a":{"b":"c","d":1}}`, `{"a":{"b":"d"}}`},
+		{`{"a":[1,2]}`, `{"a":[1]}`},
+		{`{"a":1}`, `{"a":1}`},
+		{`["a"]`, `{"a":"b"}`},
+		{`{"a":"b"}`, `"c"`},
+	}
+	for _, test := range tests {
+		old, new := &JSONValue{[]byte(test.old)}, &JSONValue{[]byte(test.new)}
+		patch, err := CreateMergePatch(old, new)
+		if err != nil {
+			t.Errorf("CreateMergePatch(%s, %s) failed: %v", test.old, test.new, err)
+			continue
+		}
+		result, err := ApplyMergePatch(old, patch)
+		if err != nil {
+			t.Errorf("ApplyMergePatch(%s, %s) failed: %v", test.old, patch.ToString(), err)
+			continue
+		}
+		if !jsonEqual(t, result, test.new) {
+			t.Errorf("CreateMergePatch(%s, %s) = %s, which applies as %s", test.old, test.new, patch.ToString(), result.ToString())
+		}
+	}
+}
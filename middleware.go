@@ -0,0 +1,217 @@
+/*
+ * Copyright (c) 2017, 2020 ADLINK Technology Inc.
+ *
+ * This program and the accompanying materials are made available under the
+ * terms of the Eclipse Public License 2.0 which is available at
+ * http://www.eclipse.org/legal/epl-2.0, or the Apache License, Version 2.0
+ * which is available at https://www.apache.org/licenses/LICENSE-2.0.
+ *
+ * SPDX-License-Identifier: EPL-2.0 OR Apache-2.0
+ *
+ * Contributors:
+ *   ADLINK zenoh team, <zenoh@adlink-labs.tech>
+ */
+
+package zenoh
+
+import (
+	"context"
+	"fmt"
+	"runtime/debug"
+	"time"
+
+	log "github.com/sirupsen/logrus"
+)
+
+// Operation is the kind of operation intercepted by a Middleware
+type Operation uint8
+
+const (
+	// OpPut : a put, via the Workspace or one of its Publishers.
+	OpPut Operation = iota
+	// OpUpdate : an update, via the Workspace or one of its Publishers.
+	OpUpdate
+	// OpRemove : a remove, via the Workspace or one of its Publishers.
+	OpRemove
+	// OpGet : a query, via Get(), GetWithContext(), GetWithOptions(), GetRange(), GetRangeExpr() or GetStream().
+	// For GetStream(), only the issuing of the query is intercepted.
+	OpGet
+	// OpListener : the call of a listener registered via Subscribe() or SubscribeWithOptions(),
+	// the push of the changes to the channel of a ChanSubscription, or their application to a Cache.
+	OpListener
+	// OpEval : the call of a function registered as an eval.
+	OpEval
+)
+
+// ToString returns the Operation as a string
+func (op Operation) ToString() string {
+	switch op {
+	case OpPut:
+		return "Put"
+	case OpUpdate:
+		return "Update"
+	case OpRemove:
+		return "Remove"
+	case OpGet:
+		return "Get"
+	case OpListener:
+		return "Listener"
+	case OpEval:
+		return "Eval"
+	default:
+		return "Unknown"
+	}
+}
+
+// Invocation describes an operation intercepted by a Middleware.
+type Invocation struct {
+	// Op is the kind of operation.
+	Op Operation
+	// Target is the absolute path (for OpPut, OpUpdate, OpRemove and OpEval)
+	// or selector (for OpGet and OpListener) of the operation.
+	Target string
+	// Context is the context of the operation (context.Background() if it has none).
+	Context context.Context
+	// Changes are the changes notified to the listener, for OpListener.
+	Changes []Change
+	// Request is the request passed to the eval, for OpEval.
+	Request *EvalRequest
+}
+
+// Handler is an intercepted operation. It returns the error of the operation, if any.
+type Handler func() error
+
+// Middleware intercepts the operations of a Workspace (see Workspace.Use()).
+// It must call next to continue the operation, and return its error (possibly changed),
+// or return an error without calling next to abort the operation.
+type Middleware func(inv *Invocation, next Handler) error
+
+// Use adds middlewares intercepting the operations of the Workspace: the puts, updates and
+// removes (including via its Publishers), the queries, and the calls of the listeners and evals
+// registered via the Workspace. The first added Middleware is the outermost one.
+//
+// The middlewares apply to the operations started after the call of Use, including for the
+// listeners and evals already registered. The errors of the listeners' invocations are logged.
+func (w *Workspace) Use(middlewares ...Middleware) {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	chain, _ := w.middlewares.Load().(Middleware)
+	for _, mw := range middlewares {
+		if mw != nil {
+			chain = chainMiddlewares(chain, mw)
+		}
+	}
+	if chain != nil {
+		w.middlewares.Store(chain)
+	}
+}
+
+// chainMiddlewares returns the Middleware calling inner through outer (if not nil).
+func chainMiddlewares(outer Middleware, inner Middleware) Middleware {
+	if outer == nil {
+		return inner
+	}
+	return func(inv *Invocation, next Handler) error {
+		return outer(inv, func() error { return inner(inv, next) })
+	}
+}
+
+// intercept executes the operation h through the middlewares of the Workspace.
+func (w *Workspace) intercept(inv *Invocation, h Handler) error {
+	chain, _ := w.middlewares.Load().(Middleware)
+	if chain == nil {
+		return h()
+	}
+	if inv.Context == nil {
+		inv.Context = context.Background()
+	}
+	return chain(inv, h)
+}
+
+// writeOperation returns the Operation corresponding to a ChangeKind.
+func writeOperation(kind ChangeKind) Operation {
+	switch kind {
+	case UPDATE:
+		return OpUpdate
+	case REMOVE:
+		return OpRemove
+	default:
+		return OpPut
+	}
+}
+
+// interceptListener returns a Listener calling listener through the middlewares of the Workspace.
+func (w *Workspace) interceptListener(s *Selector, listener Listener) Listener {
+	return func(changes []Change) {
+		if w.middlewares.Load() == nil {
+			listener(changes)
+			return
+		}
+		inv := &Invocation{Op: OpListener, Target: s.ToString(), Changes: changes}
+		err := w.intercept(inv, func() error {
+			listener(changes)
+			return nil
+		})
+		if err != nil {
+			logger.WithFields(log.Fields{
+				"selector": s,
+				"error":    err,
+			}).Warn("Listener failed")
+		}
+	}
+}
+
+// LoggingMiddleware returns a Middleware logging each operation with its duration and error,
+// with the fields "op", "target", "duration" and "error".
+// The failed operations are logged at Warn level, the others at the provided level.
+// If entry is nil, the zenoh logger is used.
+func LoggingMiddleware(entry *log.Entry, level log.Level) Middleware {
+	if entry == nil {
+		entry = logger
+	}
+	return func(inv *Invocation, next Handler) error {
+		start := time.Now()
+		err := next()
+		e := entry.WithFields(log.Fields{
+			"op":       inv.Op.ToString(),
+			"target":   inv.Target,
+			"duration": time.Since(start),
+		})
+		if err != nil {
+			e.WithField("error", err).Warn("Operation failed")
+		} else {
+			e.Log(level, "Operation done")
+		}
+		return err
+	}
+}
+
+// LatencyMiddleware returns a Middleware measuring the duration of each operation,
+// and passing it to observe with the Invocation and the error of the operation.
+func LatencyMiddleware(observe func(inv *Invocation, d time.Duration, err error)) Middleware {
+	return func(inv *Invocation, next Handler) error {
+		start := time.Now()
+		err := next()
+		observe(inv, time.Since(start), err)
+		return err
+	}
+}
+
+// RecoverMiddleware returns a Middleware converting the panics occurring during
+// the operations (e.g. in listeners or evals) into *ZError, logged with their stack trace.
+func RecoverMiddleware() Middleware {
+	return func(inv *Invocation, next Handler) (err error) {
+		defer func() {
+			if r := recover(); r != nil {
+				logger.WithFields(log.Fields{
+					"op":     inv.Op.ToString(),
+					"target": inv.Target,
+					"error":  r,
+					"stack":  string(debug.Stack()),
+				}).Error("Panic during operation")
+				err = &ZError{Msg: fmt.Sprintf("Panic during %s on %s: %v", inv.Op.ToString(), inv.Target, r), Code: 0, Cause: nil}
+			}
+		}()
+		return next()
+	}
+}
@@ -0,0 +1,63 @@
+/*
+ * Copyright (c) 2017, 2020 ADLINK Technology Inc.
+ *
+ * This program and the accompanying materials are made available under the
+ * terms of the Eclipse Public License 2.0 which is available at
+ * http://www.eclipse.org/legal/epl-2.0, or the Apache License, Version 2.0
+ * which is available at https://www.apache.org/licenses/LICENSE-2.0.
+ *
+ * SPDX-License-Identifier: EPL-2.0 OR Apache-2.0
+ *
+ * Contributors:
+ *   ADLINK zenoh team, <zenoh@adlink-labs.tech>
+ */
+
+package zenoh
+
+import (
+	"errors"
+	"reflect"
+	"sync"
+	"testing"
+)
+
+func TestMiddlewareOrder(t *testing.T) {
+	w := &Workspace{mu: new(sync.Mutex)}
+	calls := make([]string, 0)
+	record := func(name string) Middleware {
+		return func(inv *Invocation, next Handler) error {
+			calls = append(calls, name+">")
+			err := next()
+			calls = append(calls, "<"+name)
+			return err
+		}
+	}
+	if err := w.intercept(&Invocation{Op: OpPut}, func() error { calls = append(calls, "h"); return nil }); err != nil {
+		t.Fatal(err)
+	}
+	w.Use(record("a"), record("b"))
+	w.Use(record("c"))
+	calls = calls[:0]
+	if err := w.intercept(&Invocation{Op: OpPut}, func() error { calls = append(calls, "h"); return nil }); err != nil {
+		t.Fatal(err)
+	}
+	expected := []string{"a>", "b>", "c>", "h", "<c", "<b", "<a"}
+	if !reflect.DeepEqual(calls, expected) {
+		t.Errorf("calls %v, expected %v", calls, expected)
+	}
+}
+
+func TestRecoverMiddleware(t *testing.T) {
+	w := &Workspace{mu: new(sync.Mutex)}
+	w.Use(RecoverMiddleware())
+	err := w.intercept(&Invocation{Op: OpEval, Target: "/a"}, func() error { panic("boom") })
+	if _, ok := err.(*ZError); !ok {
+		t.Errorf("panic converted into %v, expected a *ZError", err)
+	}
+	abort := errors.New("abort")
+	w.Use(func(inv *Invocation, next Handler) error { return abort })
+	called := false
+	if err := w.intercept(&Invocation{Op: OpPut}, func() error { called = true; return nil }); err != abort || called {
+		t.Errorf("aborting middleware returned %v, handler called: %v", err, called)
+	}
+}
@@ -42,6 +42,7 @@ import (
 	"runtime/debug"
 	"strconv"
 	"sync"
+	"sync/atomic"
 	"unsafe"
 
 	log "github.com/sirupsen/logrus"
@@ -49,6 +50,42 @@ import (
 
 var logger = log.WithFields(log.Fields{" pkg": "zenoh/net"})
 
+// PanicHandler is called with the error converted from a panic that occurred in a handler
+// called by zenoh-net (DataHandler or QueryHandler), and with the stack trace of the panic.
+type PanicHandler func(err error, stack []byte)
+
+// panicHandler stores the PanicHandler set by SetPanicHandler()
+var panicHandler atomic.Value
+
+// SetPanicHandler sets the function called with the panics occurring in the handlers called by
+// zenoh-net, converted into *ZError. The zenoh-net session is not affected by such panics.
+// By default (or if h is nil), the errors are logged with their stack trace.
+func SetPanicHandler(h PanicHandler) {
+	if h == nil {
+		h = logPanic
+	}
+	panicHandler.Store(h)
+}
+
+// logPanic is the default PanicHandler
+func logPanic(err error, stack []byte) {
+	logger.WithFields(log.Fields{
+		"error": err,
+		"stack": string(stack),
+	}).Error("Panic in handler")
+}
+
+// handlePanic converts r, recovered from a panic in a handler for rname, into a *ZError
+// and passes it to the PanicHandler.
+func handlePanic(r interface{}, handler string, rname string) {
+	err := &ZError{Msg: fmt.Sprintf("Panic in %s for %s: %v", handler, rname, r), Code: 0, Cause: nil}
+	h, _ := panicHandler.Load().(PanicHandler)
+	if h == nil {
+		h = logPanic
+	}
+	h(err, debug.Stack())
+}
+
 // Open opens a zenoh-net session.
 // 'locator' is a pointer to a string representing the network endpoint to which establish the session. A typical locator looks like this : "tcp/127.0.0.1:7447".
 // 	   If 'locator' is "nil", 'open' will scout and try to establish the session automatically.
@@ -137,8 +174,7 @@ func callSubscriberDataHandler(rkey *C.zn_resource_key_t, data unsafe.Pointer, l
 
 	defer func() {
 		if r := recover(); r != nil {
-			logger.WithField("resource", rname).WithField("error", r).Warn("error in subscriber data handler for")
-			debug.PrintStack()
+			handlePanic(r, "subscriber data handler", rname)
 		}
 	}()
 
@@ -224,8 +260,7 @@ func callStorageDataHandler(rkey *C.zn_resource_key_t, data unsafe.Pointer, leng
 
 	defer func() {
 		if r := recover(); r != nil {
-			logger.WithField("resource", rname).WithField("error", r).Warn("error in storage data handler")
-			debug.PrintStack()
+			handlePanic(r, "storage data handler", rname)
 		}
 	}()
 
@@ -246,8 +281,7 @@ func callStorageQueryHandler(rname *C.char, predicate *C.char, sendReplies unsaf
 
 	defer func() {
 		if r := recover(); r != nil {
-			logger.WithField("resource", rname).WithField("error", r).Warn("error in query handle for storage")
-			debug.PrintStack()
+			handlePanic(r, "storage query handler", goRname)
 			goRepliesSender.SendReplies([]Resource{})
 		}
 	}()
@@ -318,8 +352,7 @@ func callEvalQueryHandler(rname *C.char, predicate *C.char, sendReplies unsafe.P
 
 	defer func() {
 		if r := recover(); r != nil {
-			logger.WithField("resource", rname).WithField("error", r).Warn("error in query handle for eval")
-			debug.PrintStack()
+			handlePanic(r, "eval query handler", goRname)
 			goRepliesSender.SendReplies([]Resource{})
 		}
 	}()
@@ -469,11 +502,47 @@ var replyReg = replyHandlersRegistry{new(sync.Mutex), 0, make(map[int]ReplyHandl
 
 //export callReplyHandler
 func callReplyHandler(reply *C.zn_reply_value_t, arg unsafe.Pointer) {
-	index := uintptr(arg)
-	goHandler := replyReg.rHandler[int(index)]
+	goHandler := replyHandlerFor(int(uintptr(arg)), reply.Kind() == ZNReplyFinal)
+	if goHandler == nil {
+		// the query has been released (see ReleaseQuery)
+		return
+	}
 	goHandler(reply)
 }
 
+// replyHandlerFor returns the reply handler at 'index' in replyReg (nil if it has been unregistered).
+// If 'final' is true, no more reply will come for the query and its handler is unregistered.
+func replyHandlerFor(index int, final bool) ReplyHandler {
+	replyReg.mu.Lock()
+	defer replyReg.mu.Unlock()
+	goHandler := replyReg.rHandler[index]
+	if final {
+		delete(replyReg.rHandler, index)
+	}
+	return goHandler
+}
+
+// registerReplyHandler stores 'replyHandler' in replyReg and returns its index.
+// replyReg.mu must not be held while calling zenoh-c with this index, as zenoh-c may call
+// callReplyHandler (which locks replyReg.mu) before returning.
+func registerReplyHandler(replyHandler ReplyHandler) int {
+	replyReg.mu.Lock()
+	defer replyReg.mu.Unlock()
+	replyReg.index++
+	for replyReg.rHandler[replyReg.index] != nil {
+		replyReg.index++
+	}
+	replyReg.rHandler[replyReg.index] = replyHandler
+	return replyReg.index
+}
+
+// unregisterReplyHandler removes the reply handler at 'index' from replyReg.
+func unregisterReplyHandler(index int) {
+	replyReg.mu.Lock()
+	delete(replyReg.rHandler, index)
+	replyReg.mu.Unlock()
+}
+
 // Query queries data matching resource name 'resource'.
 // 'resource' is the resource to query.
 // 'predicate' is a string that will be  propagated to the storages and evals that should provide the queried data.
@@ -485,19 +554,14 @@ func (s *Session) Query(resource string, predicate string, replyHandler ReplyHan
 	p := C.CString(predicate)
 	defer C.free(unsafe.Pointer(p))
 
-	replyReg.mu.Lock()
-	defer replyReg.mu.Unlock()
-	replyReg.index++
-	for replyReg.rHandler[replyReg.index] != nil {
-		replyReg.index++
-	}
-	replyReg.rHandler[replyReg.index] = replyHandler
+	index := registerReplyHandler(replyHandler)
 
 	result := C.zn_query(s, r, p,
 		(C.zn_reply_handler_t)(unsafe.Pointer(C.handle_reply_cgo)),
-		unsafe.Pointer(uintptr(replyReg.index)))
+		unsafe.Pointer(uintptr(index)))
 	if result != 0 {
-		return &ZError{"zn_query on " + resource + "failed", int(result), nil}
+		unregisterReplyHandler(index)
+		return &ZError{"zn_query on " + resource + " failed", int(result), nil}
 	}
 	return nil
 }
@@ -510,27 +574,40 @@ func (s *Session) Query(resource string, predicate string, replyHandler ReplyHan
 // 'destStorages' indicates which matching storages should be destination of the query.
 // 'destEvals' indicates which matching evals should be destination of the query.
 func (s *Session) QueryWO(resource string, predicate string, replyHandler ReplyHandler, destStorages QueryDest, destEvals QueryDest) error {
+	_, err := s.StartQuery(resource, predicate, replyHandler, destStorages, destEvals)
+	return err
+}
+
+// StartQuery queries data matching resource name 'resource', as QueryWO() does, and returns a handle on the query.
+// 'replyHandler' is unregistered once it has been called with the ZNReplyFinal reply.
+// The returned Query can be passed to 'Session.ReleaseQuery()' to stop receiving replies before this final reply.
+func (s *Session) StartQuery(resource string, predicate string, replyHandler ReplyHandler, destStorages QueryDest, destEvals QueryDest) (*Query, error) {
 	r := C.CString(resource)
 	defer C.free(unsafe.Pointer(r))
 	p := C.CString(predicate)
 	defer C.free(unsafe.Pointer(p))
 
-	replyReg.mu.Lock()
-	defer replyReg.mu.Unlock()
-	replyReg.index++
-	for replyReg.rHandler[replyReg.index] != nil {
-		replyReg.index++
-	}
-	replyReg.rHandler[replyReg.index] = replyHandler
+	index := registerReplyHandler(replyHandler)
 
 	result := C.zn_query_wo(s, r, p,
 		(C.zn_reply_handler_t)(unsafe.Pointer(C.handle_reply_cgo)),
-		unsafe.Pointer(uintptr(replyReg.index)),
+		unsafe.Pointer(uintptr(index)),
 		destStorages, destEvals)
 	if result != 0 {
-		return &ZError{"zn_query on " + resource + "failed", int(result), nil}
+		unregisterReplyHandler(index)
+		return nil, &ZError{"zn_query_wo on " + resource + " failed", int(result), nil}
 	}
-	return nil
+
+	query := new(Query)
+	query.regIndex = index
+
+	return query, nil
+}
+
+// ReleaseQuery unregisters the reply handler of the query 'q'.
+// The replies received afterwards for this query are ignored.
+func (s *Session) ReleaseQuery(q *Query) {
+	unregisterReplyHandler(q.regIndex)
 }
 
 // UndeclareSubscriber undeclares the subscription 's'.
@@ -0,0 +1,56 @@
+/*
+ * Copyright (c) 2017, 2020 ADLINK Technology Inc.
+ *
+ * This program and the accompanying materials are made available under the
+ * terms of the Eclipse Public License 2.0 which is available at
+ * http://www.eclipse.org/legal/epl-2.0, or the Apache License, Version 2.0
+ * which is available at https://www.apache.org/licenses/LICENSE-2.0.
+ *
+ * SPDX-License-Identifier: EPL-2.0 OR Apache-2.0
+ *
+ * Contributors:
+ *   ADLINK zenoh team, <zenoh@adlink-labs.tech>
+ */
+
+package net
+
+import (
+	"testing"
+)
+
+func TestReplyHandlersRegistry(t *testing.T) {
+	h := func(*ReplyValue) {}
+	i1 := registerReplyHandler(h)
+	i2 := registerReplyHandler(h)
+	if i1 == i2 {
+		t.Fatalf("2 reply handlers registered at index %d", i1)
+	}
+	if replyHandlerFor(i1, false) == nil {
+		t.Error("reply handler not found")
+	}
+	if replyHandlerFor(i1, true) == nil {
+		t.Error("reply handler not found for the final reply")
+	}
+	if replyHandlerFor(i1, false) != nil {
+		t.Error("reply handler still registered after the final reply")
+	}
+	// released query
+	unregisterReplyHandler(i2)
+	if replyHandlerFor(i2, false) != nil {
+		t.Error("reply handler still registered after unregistration")
+	}
+}
+
+func TestReplyHandlersRegistrySkipsUsedIndexes(t *testing.T) {
+	h := func(*ReplyValue) {}
+	i := registerReplyHandler(h)
+	defer unregisterReplyHandler(i)
+	replyReg.mu.Lock()
+	replyReg.index = i - 1
+	replyReg.mu.Unlock()
+	j := registerReplyHandler(h)
+	defer unregisterReplyHandler(j)
+	if j == i {
+		t.Errorf("reply handler registered at the used index %d", i)
+	}
+}
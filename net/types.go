@@ -24,6 +24,7 @@ inline void call_replies_sender(zn_replies_sender_t send_replies, void *query_ha
 */
 import "C"
 import (
+	"time"
 	"unsafe"
 
 	zcore "github.com/eclipse-zenoh/zenoh-go/core"
@@ -85,6 +86,11 @@ type Eval struct {
 	zeval    *C.zn_eva_t
 }
 
+// Query is a pending Zenoh query (see Session.StartQuery())
+type Query struct {
+	regIndex int
+}
+
 // Resource is a Zenoh resource with a name and a value (data).
 type Resource struct {
 	RName    string
@@ -186,6 +192,13 @@ func NewSubModeWithTime(kind SubModeKind, origin C.ulong, period C.ulong, durati
 	return SubMode{kind, C.zn_temporal_property_t{origin, period, duration}}
 }
 
+// NewSubModeWithDurations returns a SubMode with the specified kind and temporal properties,
+// given as durations (with a milliseconds precision).
+func NewSubModeWithDurations(kind SubModeKind, origin time.Duration, period time.Duration, duration time.Duration) SubMode {
+	return NewSubModeWithTime(kind,
+		C.ulong(origin/time.Millisecond), C.ulong(period/time.Millisecond), C.ulong(duration/time.Millisecond))
+}
+
 // QueryDest is a data structure defining which storages or evals should be destination of a query
 // (see Session.QueryWO())
 type QueryDest = C.zn_query_dest_t
@@ -0,0 +1,160 @@
+/*
+ * Copyright (c) 2017, 2020 ADLINK Technology Inc.
+ *
+ * This program and the accompanying materials are made available under the
+ * terms of the Eclipse Public License 2.0 which is available at
+ * http://www.eclipse.org/legal/epl-2.0, or the Apache License, Version 2.0
+ * which is available at https://www.apache.org/licenses/LICENSE-2.0.
+ *
+ * SPDX-License-Identifier: EPL-2.0 OR Apache-2.0
+ *
+ * Contributors:
+ *   ADLINK zenoh team, <zenoh@adlink-labs.tech>
+ */
+
+package zenoh
+
+import (
+	"regexp"
+	"strconv"
+	"strings"
+)
+
+// PathExpr is a path expression, i.e. a string similar to a Path but with wildcards and captures allowed.
+// As in a Selector, a single '*' matches any set of characters in a path, except '/',
+// while "**" matches any set of characters in a path, including '/'.
+// A segment of the form "{name}" matches any non-empty segment, and captures it as name.
+//
+// Examples of path expressions:
+//   "/sensors/*/avg"
+//   "/sensors/{id}/avg"
+//   "/building/**/temperature"
+//
+// A path expression can be absolute (i.e. starting with a '/') or relative to a Workspace.
+type PathExpr struct {
+	expr     string
+	rname    string
+	captures []string
+	regex    *regexp.Regexp
+	literal  int // number of leading segments that cannot be captures
+}
+
+var captureRegexp = regexp.MustCompile("^{([A-Za-z_][A-Za-z0-9_]*)}$")
+
+// NewPathExpr returns a new PathExpr from the string e, if it's a valid path expression.
+// Otherwise, it returns an error.
+func NewPathExpr(e string) (*PathExpr, error) {
+	if len(e) == 0 {
+		return nil, &ZError{Msg: "Invalid path expression (empty String)", Code: 0, Cause: nil}
+	}
+	for i, c := range e {
+		if c == '?' || c == '#' || c == '[' || c == ']' {
+			return nil, &ZError{
+				Msg:  "Invalid path expression: " + e + " (forbidden character at index " + strconv.Itoa(i) + ")",
+				Code: 0, Cause: nil}
+		}
+	}
+	return newPathExpr(removeUselessSlashes(e), 0)
+}
+
+// pathExprOf returns the PathExpr matching only the Path p.
+func pathExprOf(p *Path) *PathExpr {
+	pe, _ := newPathExpr(p.path, strings.Count(p.path, "/")+1)
+	return pe
+}
+
+func newPathExpr(e string, literal int) (*PathExpr, error) {
+	segments := strings.Split(e, "/")
+	// consecutive "**" segments are equivalent to a single one
+	for i := len(segments) - 1; i > literal; i-- {
+		if segments[i] == "**" && segments[i-1] == "**" {
+			segments = append(segments[:i], segments[i+1:]...)
+		}
+	}
+	e = strings.Join(segments, "/")
+	rname := make([]string, len(segments))
+	regex := make([]string, len(segments))
+	captures := make([]string, 0)
+	for i, seg := range segments {
+		if m := captureRegexp.FindStringSubmatch(seg); i >= literal && m != nil {
+			for _, c := range captures {
+				if c == m[1] {
+					return nil, &ZError{Msg: "Invalid path expression: " + e + " (duplicate capture " + c + ")", Code: 0, Cause: nil}
+				}
+			}
+			captures = append(captures, m[1])
+			rname[i] = "*"
+			regex[i] = "(?P<" + m[1] + ">[^/]+)"
+			continue
+		}
+		rname[i] = seg
+		parts := strings.Split(seg, "**")
+		for j, part := range parts {
+			subparts := strings.Split(part, "*")
+			for k := range subparts {
+				subparts[k] = regexp.QuoteMeta(subparts[k])
+			}
+			parts[j] = strings.Join(subparts, "[^/]*")
+		}
+		regex[i] = strings.Join(parts, ".*")
+	}
+	// a "**" segment also matches no segment at all
+	r := strings.Replace("^"+strings.Join(regex, "/")+"$", "/.*/", "(?:/.*)?/", -1)
+	r = strings.Replace(r, "/.*$", "(?:/.*)?$", 1)
+	return &PathExpr{e, strings.Join(rname, "/"), captures, regexp.MustCompile(r), literal}, nil
+}
+
+// ToString returns the PathExpr as a string
+func (pe *PathExpr) ToString() string {
+	return pe.expr
+}
+
+// IsRelative returns true if the PathExpr is not absolute (i.e. it doesn't start with '/')
+func (pe *PathExpr) IsRelative() bool {
+	return len(pe.expr) == 0 || pe.expr[0] != '/'
+}
+
+// AddPrefix returns a new PathExpr made from the concatenation of the prefix and this path expression.
+func (pe *PathExpr) AddPrefix(prefix *Path) *PathExpr {
+	result, _ := newPathExpr(prefix.path+"/"+pe.expr, strings.Count(prefix.path, "/")+1+pe.literal)
+	return result
+}
+
+// IsPath returns true if the PathExpr contains neither wildcards nor captures,
+// i.e. it matches a single Path.
+func (pe *PathExpr) IsPath() bool {
+	return !strings.Contains(pe.rname, "*")
+}
+
+// Captures returns the names of the captures of the PathExpr, in order of appearance.
+func (pe *PathExpr) Captures() []string {
+	return pe.captures
+}
+
+// Match returns true if the Path p matches the PathExpr, with the segments captured by the PathExpr.
+func (pe *PathExpr) Match(p *Path) (bool, map[string]string) {
+	m := pe.regex.FindStringSubmatch(p.path)
+	if m == nil {
+		return false, nil
+	}
+	captured := make(map[string]string)
+	for i, name := range pe.regex.SubexpNames() {
+		if name != "" {
+			captured[name] = m[i]
+		}
+	}
+	return true, captured
+}
+
+// rnameMatcher returns a function returning true if a Path matches the path expression expr,
+// as zenoh does (i.e. considering the wildcards, but not the captures).
+// expr is compiled once, so the returned function can be called for many Paths.
+func rnameMatcher(expr string) func(p *Path) bool {
+	pe, err := newPathExpr(removeUselessSlashes(expr), strings.Count(expr, "/")+1)
+	if err != nil {
+		return func(*Path) bool { return false }
+	}
+	return func(p *Path) bool {
+		return pe.regex.MatchString(p.path)
+	}
+}
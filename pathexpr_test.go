@@ -0,0 +1,142 @@
+/*
+ * Copyright (c) 2017, 2020 ADLINK Technology Inc.
+ *
+ * This program and the accompanying materials are made available under the
+ * terms of the Eclipse Public License 2.0 which is available at
+ * http://www.eclipse.org/legal/epl-2.0, or the Apache License, Version 2.0
+ * which is available at https://www.apache.org/licenses/LICENSE-2.0.
+ *
+ * SPDX-License-Identifier: EPL-2.0 OR Apache-2.0
+ *
+ * Contributors:
+ *   ADLINK zenoh team, <zenoh@adlink-labs.tech>
+ */
+
+package zenoh
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestNewPathExpr(t *testing.T) {
+	tests := []struct {
+		e        string
+		expr     string
+		rname    string
+		captures []string
+		isPath   bool
+		err      bool
+	}{
+		{"/a/b", "/a/b", "/a/b", []string{}, true, false},
+		{"//a//b/", "/a/b", "/a/b", []string{}, true, false},
+		{"/a/*/c", "/a/*/c", "/a/*/c", []string{}, false, false},
+		{"/a/{id}/{x_1}", "/a/{id}/{x_1}", "/a/*/*", []string{"id", "x_1"}, false, false},
+		{"/a/{1x}", "/a/{1x}", "/a/{1x}", []string{}, true, false},
+		{"/a/**", "/a/**", "/a/**", []string{}, false, false},
+		{"/a/**/**/b/**/**", "/a/**/b/**", "/a/**/b/**", []string{}, false, false},
+		{"", "", "", nil, false, true},
+		{"/a?x", "", "", nil, false, true},
+		{"/a#x", "", "", nil, false, true},
+		{"/a/{id}/{id}", "", "", nil, false, true},
+	}
+	for _, test := range tests {
+		pe, err := NewPathExpr(test.e)
+		if test.err {
+			if err == nil {
+				t.Errorf("NewPathExpr(%q) = %s, expected an error", test.e, pe.ToString())
+			}
+			continue
+		}
+		if err != nil {
+			t.Errorf("NewPathExpr(%q) failed: %v", test.e, err)
+			continue
+		}
+		if pe.ToString() != test.expr || pe.rname != test.rname || !reflect.DeepEqual(pe.Captures(), test.captures) {
+			t.Errorf("NewPathExpr(%q) = %q (rname %q, captures %v), expected %q (rname %q, captures %v)",
+				test.e, pe.ToString(), pe.rname, pe.Captures(), test.expr, test.rname, test.captures)
+		}
+		if pe.IsPath() != test.isPath {
+			t.Errorf("NewPathExpr(%q).IsPath() = %v", test.e, pe.IsPath())
+		}
+	}
+}
+
+func TestPathExprMatch(t *testing.T) {
+	tests := []struct {
+		e        string
+		p        string
+		match    bool
+		captured map[string]string
+	}{
+		{"/a/b", "/a/b", true, map[string]string{}},
+		{"/a/b", "/a/b/c", false, nil},
+		{"/a/b", "/a/bc", false, nil},
+		{"/a/*", "/a/b", true, map[string]string{}},
+		{"/a/*", "/a/b/c", false, nil},
+		{"/a/*/c", "/a/b/c", true, map[string]string{}},
+		{"/a/b*", "/a/bcd", true, map[string]string{}},
+		{"/a/b*", "/a/cb", false, nil},
+		{"/a/**", "/a/b", true, map[string]string{}},
+		{"/a/**", "/a/b/c/d", true, map[string]string{}},
+		{"/a/**", "/a", true, map[string]string{}},
+		{"/a/**", "/ab", false, nil},
+		{"/a/**/d", "/a/d", true, map[string]string{}},
+		{"/a/**/d", "/a/b/c/d", true, map[string]string{}},
+		{"/a/**/d", "/a/b/c/e", false, nil},
+		{"/**", "/a/b", true, map[string]string{}},
+		{"/a/**/**/b", "/a/b", true, map[string]string{}},
+		{"/a/**/**/b", "/a/x/y/b", true, map[string]string{}},
+		{"/**/**", "/a", true, map[string]string{}},
+		{"/a/.", "/a/b", false, nil},
+		{"/a/{id}/avg", "/a/s1/avg", true, map[string]string{"id": "s1"}},
+		{"/a/{id}/avg", "/a/avg", false, nil},
+		{"/a/{id}/avg", "/a/s1/s2/avg", false, nil},
+		{"/{x}/**/{y}", "/a/b/c/d", true, map[string]string{"x": "a", "y": "d"}},
+		{"/{x}/**/{y}", "/a/d", true, map[string]string{"x": "a", "y": "d"}},
+	}
+	for _, test := range tests {
+		pe, err := NewPathExpr(test.e)
+		if err != nil {
+			t.Fatalf("NewPathExpr(%q) failed: %v", test.e, err)
+		}
+		p, err := NewPath(test.p)
+		if err != nil {
+			t.Fatalf("NewPath(%q) failed: %v", test.p, err)
+		}
+		match, captured := pe.Match(p)
+		if match != test.match || !reflect.DeepEqual(captured, test.captured) {
+			t.Errorf("%q Match %q = %v, %v, expected %v, %v", test.e, test.p, match, captured, test.match, test.captured)
+		}
+		if !test.match && len(test.captured) == 0 && rnameMatcher(test.e)(p) {
+			t.Errorf("rnameMatcher(%q) matches %q", test.e, test.p)
+		}
+	}
+}
+
+func TestPathExprAddPrefix(t *testing.T) {
+	prefix, _ := NewPath("/{w}")
+	pe, err := NewPathExpr("{id}/avg")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !pe.IsRelative() {
+		t.Errorf("%q is not relative", pe.ToString())
+	}
+	abs := pe.AddPrefix(prefix)
+	if abs.ToString() != "/{w}/{id}/avg" || abs.IsRelative() {
+		t.Errorf("AddPrefix() = %q", abs.ToString())
+	}
+	// the segments of the prefix are not captures
+	if !reflect.DeepEqual(abs.Captures(), []string{"id"}) {
+		t.Errorf("AddPrefix() captures %v, expected [id]", abs.Captures())
+	}
+	p, _ := NewPath("/{w}/s1/avg")
+	if ok, captured := abs.Match(p); !ok || !reflect.DeepEqual(captured, map[string]string{"id": "s1"}) {
+		t.Errorf("%q Match %q = %v, %v", abs.ToString(), p.ToString(), ok, captured)
+	}
+	root, _ := NewPath("/")
+	if abs := pe.AddPrefix(root); abs.ToString() != "/{id}/avg" {
+		t.Errorf("AddPrefix(/) = %q", abs.ToString())
+	}
+}
@@ -0,0 +1,279 @@
+/*
+ * Copyright (c) 2017, 2020 ADLINK Technology Inc.
+ *
+ * This program and the accompanying materials are made available under the
+ * terms of the Eclipse Public License 2.0 which is available at
+ * http://www.eclipse.org/legal/epl-2.0, or the Apache License, Version 2.0
+ * which is available at https://www.apache.org/licenses/LICENSE-2.0.
+ *
+ * SPDX-License-Identifier: EPL-2.0 OR Apache-2.0
+ *
+ * Contributors:
+ *   ADLINK zenoh team, <zenoh@adlink-labs.tech>
+ */
+
+package zenoh
+
+import (
+	"bytes"
+	"encoding/json"
+	"strconv"
+	"strings"
+)
+
+// Operator is a comparison operator used in a Predicate's Condition.
+type Operator uint8
+
+const (
+	// LT is the "<" operator
+	LT Operator = iota
+	// GT is the ">" operator
+	GT
+	// LE is the "<=" operator
+	LE
+	// GE is the ">=" operator
+	GE
+	// EQ is the "=" operator
+	EQ
+	// NE is the "!=" operator
+	NE
+)
+
+var operatorStrings = map[Operator]string{LT: "<", GT: ">", LE: "<=", GE: ">=", EQ: "=", NE: "!="}
+
+// ToString returns the Operator as a string
+func (op Operator) ToString() string {
+	return operatorStrings[op]
+}
+
+// Condition is an elementary predicate, comparing a field of a Value with a constant.
+type Condition struct {
+	Field    string
+	Operator Operator
+	Value    string
+}
+
+// ToString returns the Condition as a string
+func (c *Condition) ToString() string {
+	return c.Field + c.Operator.ToString() + c.Value
+}
+
+// Predicate is the parsed filter part of a Selector (e.g. "x>1&y<2"):
+// a conjunction of Conditions.
+//
+// A Condition's field is looked up in the Value as following:
+//
+// - JSON: the field is a (possibly nested, e.g. "a.b") field of a JSON object.
+//
+// - PROPERTIES: the field is a property key.
+//
+// - INT and FLOAT: the Value itself is the field named "value" (e.g. "value>1"). Any other field doesn't exist.
+//
+// If the field doesn't exist in the Value, or the Value has another encoding,
+// the Condition is false.
+// The field value and the constant are compared as numbers if both are numbers, as strings otherwise.
+// Two integers are compared exactly, other numbers as float64.
+// A constant surrounded with single or double quotes is always compared as a string.
+// A constant cannot start with an operator character unless it's quoted (e.g. "x=='1'" is invalid).
+type Predicate struct {
+	Conditions []Condition
+}
+
+// ParsePredicate returns a new Predicate from the string p, if it's a valid filter specification.
+// Otherwise, it returns an error.
+func ParsePredicate(p string) (*Predicate, error) {
+	result := &Predicate{make([]Condition, 0)}
+	if len(p) == 0 {
+		return result, nil
+	}
+	for _, c := range strings.Split(p, "&") {
+		i := strings.IndexAny(c, "<>=!")
+		if i <= 0 {
+			return nil, &ZError{Msg: "Invalid predicate: " + p + " (no field or operator in '" + c + "')",
+				Code: 0, Cause: nil}
+		}
+		cond := Condition{Field: strings.TrimSpace(c[:i])}
+		rest := c[i:]
+		switch {
+		case strings.HasPrefix(rest, "<="):
+			cond.Operator, rest = LE, rest[2:]
+		case strings.HasPrefix(rest, ">="):
+			cond.Operator, rest = GE, rest[2:]
+		case strings.HasPrefix(rest, "!="):
+			cond.Operator, rest = NE, rest[2:]
+		case strings.HasPrefix(rest, "<"):
+			cond.Operator, rest = LT, rest[1:]
+		case strings.HasPrefix(rest, ">"):
+			cond.Operator, rest = GT, rest[1:]
+		case strings.HasPrefix(rest, "="):
+			cond.Operator, rest = EQ, rest[1:]
+		default:
+			return nil, &ZError{Msg: "Invalid predicate: " + p + " (unknown operator in '" + c + "')",
+				Code: 0, Cause: nil}
+		}
+		cond.Value = strings.TrimSpace(rest)
+		if strings.IndexAny(cond.Value, "<>=!") == 0 {
+			// e.g. "x==1"
+			return nil, &ZError{Msg: "Invalid predicate: " + p + " (invalid operator in '" + c + "')",
+				Code: 0, Cause: nil}
+		}
+		result.Conditions = append(result.Conditions, cond)
+	}
+	return result, nil
+}
+
+// ToString returns the Predicate as a string
+func (p *Predicate) ToString() string {
+	conds := make([]string, len(p.Conditions))
+	for i := range p.Conditions {
+		conds[i] = p.Conditions[i].ToString()
+	}
+	return strings.Join(conds, "&")
+}
+
+// IsEmpty returns true if the Predicate has no Condition (i.e. it matches any Value)
+func (p *Predicate) IsEmpty() bool {
+	return len(p.Conditions) == 0
+}
+
+// Match returns true if the Value v satisfies all the Conditions of the Predicate.
+func (p *Predicate) Match(v Value) bool {
+	return p.match(v.Encoding(), v)
+}
+
+// match returns true if the Value v, received with the specified encoding, satisfies the Predicate.
+func (p *Predicate) match(encoding Encoding, v Value) bool {
+	if p.IsEmpty() {
+		return true
+	}
+	var lookup func(field string) (interface{}, bool)
+	switch encoding {
+	case JSON:
+		// decode the numbers as json.Number, for the integers to be compared exactly
+		dec := json.NewDecoder(bytes.NewReader(v.Encode()))
+		dec.UseNumber()
+		var doc interface{}
+		if err := dec.Decode(&doc); err != nil {
+			return false
+		}
+		lookup = func(field string) (interface{}, bool) {
+			return jsonField(doc, field)
+		}
+	case PROPERTIES:
+		props := propertiesOfString(string(v.Encode()))
+		lookup = func(field string) (interface{}, bool) {
+			s, ok := props[field]
+			return s, ok
+		}
+	case INT, FLOAT:
+		lookup = func(field string) (interface{}, bool) {
+			if field != "value" {
+				return nil, false
+			}
+			return v.ToString(), true
+		}
+	default:
+		return false
+	}
+
+	for i := range p.Conditions {
+		fv, ok := lookup(p.Conditions[i].Field)
+		if !ok || !p.Conditions[i].eval(fv) {
+			return false
+		}
+	}
+	return true
+}
+
+// jsonField returns the field in a decoded JSON document, following the '.' separated field names.
+func jsonField(doc interface{}, field string) (interface{}, bool) {
+	for _, name := range strings.Split(field, ".") {
+		obj, ok := doc.(map[string]interface{})
+		if !ok {
+			return nil, false
+		}
+		doc, ok = obj[name]
+		if !ok {
+			return nil, false
+		}
+	}
+	return doc, true
+}
+
+// eval evaluates the Condition against a field value (either a string,
+// or a value decoded from JSON).
+func (c *Condition) eval(fieldValue interface{}) bool {
+	var s string
+	switch fv := fieldValue.(type) {
+	case string:
+		s = fv
+	case json.Number:
+		s = fv.String()
+	case bool:
+		s = strconv.FormatBool(fv)
+	case nil:
+		s = "null"
+	default:
+		// JSON object or array: not comparable
+		return false
+	}
+
+	constant := c.Value
+	quoted := false
+	if len(constant) >= 2 && (constant[0] == '"' || constant[0] == '\'') && constant[len(constant)-1] == constant[0] {
+		constant = constant[1 : len(constant)-1]
+		quoted = true
+	}
+
+	cmp, ok := 0, false
+	if !quoted {
+		cmp, ok = compareNumbers(s, constant)
+	}
+	if !ok {
+		cmp = strings.Compare(s, constant)
+	}
+
+	switch c.Operator {
+	case LT:
+		return cmp < 0
+	case GT:
+		return cmp > 0
+	case LE:
+		return cmp <= 0
+	case GE:
+		return cmp >= 0
+	case EQ:
+		return cmp == 0
+	case NE:
+		return cmp != 0
+	}
+	return false
+}
+
+// compareNumbers compares s1 and s2 as integers if both are integers, as float64 otherwise.
+// It returns false if s1 or s2 is not a number.
+func compareNumbers(s1 string, s2 string) (int, bool) {
+	i1, err1 := strconv.ParseInt(s1, 10, 64)
+	i2, err2 := strconv.ParseInt(s2, 10, 64)
+	if err1 == nil && err2 == nil {
+		switch {
+		case i1 < i2:
+			return -1, true
+		case i1 > i2:
+			return 1, true
+		}
+		return 0, true
+	}
+	f1, err1 := strconv.ParseFloat(s1, 64)
+	f2, err2 := strconv.ParseFloat(s2, 64)
+	if err1 != nil || err2 != nil {
+		return 0, false
+	}
+	switch {
+	case f1 < f2:
+		return -1, true
+	case f1 > f2:
+		return 1, true
+	}
+	return 0, true
+}
@@ -0,0 +1,126 @@
+/*
+ * Copyright (c) 2017, 2020 ADLINK Technology Inc.
+ *
+ * This program and the accompanying materials are made available under the
+ * terms of the Eclipse Public License 2.0 which is available at
+ * http://www.eclipse.org/legal/epl-2.0, or the Apache License, Version 2.0
+ * which is available at https://www.apache.org/licenses/LICENSE-2.0.
+ *
+ * SPDX-License-Identifier: EPL-2.0 OR Apache-2.0
+ *
+ * Contributors:
+ *   ADLINK zenoh team, <zenoh@adlink-labs.tech>
+ */
+
+package zenoh
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestParsePredicate(t *testing.T) {
+	tests := []struct {
+		p     string
+		conds []Condition
+		err   bool
+	}{
+		{"", []Condition{}, false},
+		{"x>1", []Condition{{"x", GT, "1"}}, false},
+		{"x<1", []Condition{{"x", LT, "1"}}, false},
+		{"x>=1", []Condition{{"x", GE, "1"}}, false},
+		{"x<=1", []Condition{{"x", LE, "1"}}, false},
+		{"x=1", []Condition{{"x", EQ, "1"}}, false},
+		{"x!=1", []Condition{{"x", NE, "1"}}, false},
+		{"x>1&y<2", []Condition{{"x", GT, "1"}, {"y", LT, "2"}}, false},
+		{" a.b = 'v' ", []Condition{{"a.b", EQ, "'v'"}}, false},
+		{"x=", []Condition{{"x", EQ, ""}}, false},
+		{"x", nil, true},
+		{">1", nil, true},
+		{"x>1&", nil, true},
+		{"x!1", nil, true},
+		{"x==1", nil, true},
+		{"x=>1", nil, true},
+		{"x<>1", nil, true},
+		{"x!==1", nil, true},
+		{"x=='1'", nil, true},
+		{"x= =1", nil, true},
+	}
+	for _, test := range tests {
+		p, err := ParsePredicate(test.p)
+		if test.err {
+			if err == nil {
+				t.Errorf("ParsePredicate(%q) = %v, expected an error", test.p, p.ToString())
+			}
+			continue
+		}
+		if err != nil {
+			t.Errorf("ParsePredicate(%q) failed: %v", test.p, err)
+			continue
+		}
+		if !reflect.DeepEqual(p.Conditions, test.conds) {
+			t.Errorf("ParsePredicate(%q) = %v, expected %v", test.p, p.Conditions, test.conds)
+		}
+	}
+}
+
+func TestPredicateToString(t *testing.T) {
+	for _, s := range []string{"", "x>1", "x>=1&y!=a", "a.b='v'"} {
+		p, err := ParsePredicate(s)
+		if err != nil {
+			t.Fatalf("ParsePredicate(%q) failed: %v", s, err)
+		}
+		if p.ToString() != s {
+			t.Errorf("ParsePredicate(%q).ToString() = %q", s, p.ToString())
+		}
+	}
+}
+
+func TestPredicateMatch(t *testing.T) {
+	json := `{"x": 5, "s": "abc", "b": true, "n": null, "a": {"b": 2, "c": [1]}}`
+	tests := []struct {
+		p        string
+		encoding Encoding
+		v        Value
+		match    bool
+	}{
+		{"", RAW, NewRawValue([]byte("x")), true},
+		{"x>1", JSON, NewStringValue(json), true},
+		{"x>5", JSON, NewStringValue(json), false},
+		{"x>=5", JSON, NewStringValue(json), true},
+		{"x=5.0", JSON, NewStringValue(json), true},
+		{"x='5.0'", JSON, NewStringValue(json), false},
+		{"x>1&x<10", JSON, NewStringValue(json), true},
+		{"x>1&x<3", JSON, NewStringValue(json), false},
+		{"s=abc", JSON, NewStringValue(json), true},
+		{"s>abb", JSON, NewStringValue(json), true},
+		{"s=\"abc\"", JSON, NewStringValue(json), true},
+		{"b=true", JSON, NewStringValue(json), true},
+		{"n=null", JSON, NewStringValue(json), true},
+		{"a.b=2", JSON, NewStringValue(json), true},
+		{"a.c=1", JSON, NewStringValue(json), false},
+		{"a=1", JSON, NewStringValue(json), false},
+		{"missing=1", JSON, NewStringValue(json), false},
+		{"x>1", JSON, NewStringValue("not json"), false},
+		{"k=v", PROPERTIES, NewPropertiesValue(Properties{"k": "v"}), true},
+		{"k!=v", PROPERTIES, NewPropertiesValue(Properties{"k": "v"}), false},
+		{"big=9007199254740993", JSON, NewStringValue(`{"big": 9007199254740993}`), true},
+		{"big>9007199254740992", JSON, NewStringValue(`{"big": 9007199254740993}`), true},
+		{"x=5e0", JSON, NewStringValue(json), true},
+		{"value>1", INT, NewIntValue(2), true},
+		{"value>9007199254740992", INT, NewIntValue(9007199254740993), true},
+		{"value<1.5", FLOAT, NewFloatValue(1.25), true},
+		{"other>1", INT, NewIntValue(2), false},
+		{"x>1", STRING, NewStringValue("x=2"), false},
+		{"x>1", RAW, NewRawValue([]byte("x=2")), false},
+	}
+	for _, test := range tests {
+		p, err := ParsePredicate(test.p)
+		if err != nil {
+			t.Fatalf("ParsePredicate(%q) failed: %v", test.p, err)
+		}
+		if m := p.match(test.encoding, test.v); m != test.match {
+			t.Errorf("%q match %q (encoding %d) = %v, expected %v", test.p, test.v.ToString(), test.encoding, m, test.match)
+		}
+	}
+}
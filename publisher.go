@@ -0,0 +1,369 @@
+/*
+ * Copyright (c) 2017, 2020 ADLINK Technology Inc.
+ *
+ * This program and the accompanying materials are made available under the
+ * terms of the Eclipse Public License 2.0 which is available at
+ * http://www.eclipse.org/legal/epl-2.0, or the Apache License, Version 2.0
+ * which is available at https://www.apache.org/licenses/LICENSE-2.0.
+ *
+ * SPDX-License-Identifier: EPL-2.0 OR Apache-2.0
+ *
+ * Contributors:
+ *   ADLINK zenoh team, <zenoh@adlink-labs.tech>
+ */
+
+package zenoh
+
+import (
+	"sync"
+	"sync/atomic"
+	"time"
+
+	znet "github.com/eclipse-zenoh/zenoh-go/net"
+	log "github.com/sirupsen/logrus"
+)
+
+// Publisher allows to efficiently publish values on a single Path, via a
+// zenoh-net publisher declared once for all (see Workspace.Publisher()).
+type Publisher struct {
+	path   *Path
+	w      *Workspace
+	mu     *sync.RWMutex // held while the zenoh-net publisher is in use
+	zpub   *znet.Publisher
+	closed bool
+}
+
+// Publisher declares a Publisher for the provided Path.
+//
+// Use it for paths that are frequently written, to save the resolution of the path at each write.
+// The Publisher must be closed when no longer used, or is closed by Workspace.Close().
+func (w *Workspace) Publisher(path *Path) (*Publisher, error) {
+	p := w.toAbsolutePath(path)
+	logger.WithField("path", p).Debug("Publisher")
+	zpub, err := w.session.DeclarePublisher(p.ToString())
+	if err != nil {
+		return nil, &ZError{Msg: "Publisher on " + p.ToString() + " failed", Code: 0, Cause: err}
+	}
+	pub := &Publisher{p, w, new(sync.RWMutex), zpub, false}
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	if err := w.track(); err != nil {
+		w.session.UndeclarePublisher(zpub)
+		return nil, &ZError{Msg: "Publisher on " + p.ToString() + " failed", Code: 0, Cause: err}
+	}
+	w.pubs[pub] = true
+	return pub, nil
+}
+
+// Path returns the (absolute) Path of the Publisher
+func (p *Publisher) Path() *Path {
+	return p.path
+}
+
+// Put a value into Zenoh, for the Publisher's path.
+func (p *Publisher) Put(value Value) error {
+	logger.WithFields(log.Fields{
+		"path":  p.path,
+		"value": value,
+	}).Debug("Publisher.Put")
+	if e := p.stream(value.Encode(), value.Encoding(), PUT); e != nil {
+		return &ZError{Msg: "Put on " + p.path.ToString() + " failed", Code: 0, Cause: e}
+	}
+	return nil
+}
+
+// Update a value into Zenoh, for the Publisher's path.
+func (p *Publisher) Update(value Value) error {
+	logger.WithFields(log.Fields{
+		"path":  p.path,
+		"value": value,
+	}).Debug("Publisher.Update")
+	if e := p.stream(value.Encode(), value.Encoding(), UPDATE); e != nil {
+		return &ZError{Msg: "Update on " + p.path.ToString() + " failed", Code: 0, Cause: e}
+	}
+	return nil
+}
+
+// Remove the value of the Publisher's path from Zenoh.
+func (p *Publisher) Remove() error {
+	logger.WithField("path", p.path).Debug("Publisher.Remove")
+	if e := p.stream(nil, 0, REMOVE); e != nil {
+		return &ZError{Msg: "Remove on " + p.path.ToString() + " failed", Code: 0, Cause: e}
+	}
+	return nil
+}
+
+// Close undeclares the Publisher, after the writes in progress.
+// It does nothing if the Publisher has already been closed (e.g. by Workspace.Close()).
+// The writes via a closed Publisher return an error.
+func (p *Publisher) Close() error {
+	p.w.mu.Lock()
+	delete(p.w.pubs, p)
+	p.w.mu.Unlock()
+	if e := p.undeclare(); e != nil {
+		return &ZError{Msg: "Close of Publisher on " + p.path.ToString() + " failed", Code: 0, Cause: e}
+	}
+	return nil
+}
+
+// SetAutoPublish makes the Workspace automatically declare a publisher for each path
+// that is written (via Put, Update or Remove operations) at least threshold times
+// within the window duration. The further writes on such path use this publisher,
+// until the path is not written during a whole window duration: the publisher is then
+// undeclared.
+//
+// A threshold of 0 (or a window that is not positive) disables the automatic declaration
+// of publishers. The already declared publishers remain in use until they are idle or
+// the Workspace is closed. When the automatic declaration is disabled and no publisher
+// remains declared, the writes don't pay any bookkeeping.
+func (w *Workspace) SetAutoPublish(threshold int, window time.Duration) {
+	ap := w.autoPub
+	ap.mu.Lock()
+	defer ap.mu.Unlock()
+	if window <= 0 {
+		threshold = 0
+	} else {
+		ap.window = window
+	}
+	ap.threshold = threshold
+	ap.counts = make(map[Path]*writeCount)
+	// restart the sweeping with the new window
+	ap.stopSweeping()
+	ap.updateActive()
+}
+
+// close undeclares all the automatically declared publishers (once they are no longer
+// in use by a write), and disables the automatic declaration of publishers.
+func (ap *autoPublishers) close() []error {
+	ap.mu.Lock()
+	ap.threshold = 0
+	ap.counts = make(map[Path]*writeCount)
+	idle := ap.removeAll(func(*autoPublisher) bool { return true })
+	ap.updateActive()
+	ap.mu.Unlock()
+
+	errs := make([]error, 0)
+	for _, pub := range idle {
+		if err := ap.undeclare(pub.zpub); err != nil {
+			errs = append(errs, &ZError{Msg: "Undeclare publisher on " + pub.path.ToString() + " failed", Code: 0, Cause: err})
+		}
+	}
+	return errs
+}
+
+// write publishes a payload on the absolute Path p,
+// via a publisher if one has been automatically declared for p.
+func (w *Workspace) write(p *Path, payload []byte, encoding Encoding, kind ChangeKind) error {
+	return w.intercept(&Invocation{Op: writeOperation(kind), Target: p.ToString()}, func() error {
+		if pub := w.autoPub.publisherFor(p); pub != nil {
+			defer w.autoPub.release(pub)
+			return pub.zpub.StreamDataWO(payload, encoding, kind)
+		}
+		return w.session.WriteDataWO(p.ToString(), payload, encoding, kind)
+	})
+}
+
+// stream publishes a payload via the Publisher.
+func (p *Publisher) stream(payload []byte, encoding Encoding, kind ChangeKind) error {
+	return p.w.intercept(&Invocation{Op: writeOperation(kind), Target: p.path.ToString()}, func() error {
+		// the zenoh-net publisher is not undeclared while in use
+		p.mu.RLock()
+		defer p.mu.RUnlock()
+		if p.closed {
+			return &ZError{Msg: "Publisher on " + p.path.ToString() + " is closed", Code: 0, Cause: nil}
+		}
+		return p.zpub.StreamDataWO(payload, encoding, kind)
+	})
+}
+
+// undeclare closes the Publisher, waiting for the writes in progress, and undeclares its zenoh-net publisher.
+// It does nothing if the Publisher is already closed.
+func (p *Publisher) undeclare() error {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	if p.closed {
+		return nil
+	}
+	p.closed = true
+	return p.w.session.UndeclarePublisher(p.zpub)
+}
+
+// autoPublishers counts the writes per path within a time window,
+// and declares a publisher for the paths written more than a threshold.
+type autoPublishers struct {
+	declare   func(resource string) (*znet.Publisher, error)
+	undeclare func(*znet.Publisher) error
+
+	// active is 1 if the writes must be counted or some publishers are declared (accessed atomically)
+	active    int32
+	mu        *sync.Mutex
+	threshold int
+	window    time.Duration
+	counts    map[Path]*writeCount
+	pubs      map[Path]*autoPublisher
+	stopSweep chan struct{} // closed to stop the sweeping subroutine, nil if it's not running
+}
+
+// writeCount is the count of writes on a path since the start of its current window.
+type writeCount struct {
+	windowStart time.Time
+	count       int
+}
+
+// autoPublisher is a publisher automatically declared for a path, with the time of its last use.
+type autoPublisher struct {
+	path      *Path
+	zpub      *znet.Publisher
+	lastWrite time.Time
+	// the number of writes in progress with the publisher, which is undeclared only once it's
+	// removed (i.e. idle, or the Workspace closed) and no longer in use
+	refs    int
+	removed bool
+}
+
+func newAutoPublishers(session *znet.Session) *autoPublishers {
+	return &autoPublishers{session.DeclarePublisher, session.UndeclarePublisher, 0, new(sync.Mutex), 0, 0,
+		make(map[Path]*writeCount), make(map[Path]*autoPublisher), nil}
+}
+
+// publisherFor counts a write on the absolute Path p and returns the publisher
+// to be used for this write, or nil if there is none.
+// The returned publisher must be released once the write is done.
+func (ap *autoPublishers) publisherFor(p *Path) *autoPublisher {
+	if atomic.LoadInt32(&ap.active) == 0 {
+		return nil
+	}
+	ap.mu.Lock()
+	defer ap.mu.Unlock()
+	now := time.Now()
+	if pub, ok := ap.pubs[*p]; ok {
+		pub.lastWrite = now
+		pub.refs++
+		return pub
+	}
+	if ap.threshold <= 0 {
+		return nil
+	}
+
+	wc, ok := ap.counts[*p]
+	if !ok || now.Sub(wc.windowStart) > ap.window {
+		wc = &writeCount{windowStart: now}
+		ap.counts[*p] = wc
+	}
+	wc.count++
+	if wc.count < ap.threshold {
+		return nil
+	}
+
+	delete(ap.counts, *p)
+	zpub, err := ap.declare(p.ToString())
+	if err != nil {
+		logger.WithFields(log.Fields{
+			"path":  p,
+			"error": err,
+		}).Warn("Failed to declare a publisher for frequently written path")
+		return nil
+	}
+	logger.WithField("path", p).Debug("Declared a publisher for frequently written path")
+	pub := &autoPublisher{p, zpub, now, 1, false}
+	ap.pubs[*p] = pub
+	return pub
+}
+
+// release ends a write with a publisher returned by publisherFor(),
+// undeclaring the publisher if it has been removed meanwhile.
+func (ap *autoPublishers) release(pub *autoPublisher) {
+	ap.mu.Lock()
+	pub.refs--
+	idle := pub.removed && pub.refs == 0
+	ap.mu.Unlock()
+	if idle {
+		ap.undeclareIdle(pub)
+	}
+}
+
+// sweep drops the write counts of the windows that ended, and undeclares the publishers
+// of the paths that have not been written during a whole window.
+func (ap *autoPublishers) sweep(now time.Time) {
+	ap.mu.Lock()
+	for p, wc := range ap.counts {
+		if now.Sub(wc.windowStart) > ap.window {
+			delete(ap.counts, p)
+		}
+	}
+	idle := ap.removeAll(func(pub *autoPublisher) bool { return now.Sub(pub.lastWrite) > ap.window })
+	ap.updateActive()
+	ap.mu.Unlock()
+
+	for _, pub := range idle {
+		ap.undeclareIdle(pub)
+	}
+}
+
+func (ap *autoPublishers) undeclareIdle(pub *autoPublisher) {
+	if err := ap.undeclare(pub.zpub); err != nil {
+		logger.WithFields(log.Fields{
+			"path":  pub.path,
+			"error": err,
+		}).Warn("Failed to undeclare the publisher of an idle path")
+		return
+	}
+	logger.WithField("path", pub.path).Debug("Undeclared the publisher of an idle path")
+}
+
+// removeAll removes the publishers selected by remove, and returns those that are not in use
+// (the others are undeclared by release()).
+// ap.mu must be locked by the caller.
+func (ap *autoPublishers) removeAll(remove func(*autoPublisher) bool) []*autoPublisher {
+	idle := make([]*autoPublisher, 0)
+	for p, pub := range ap.pubs {
+		if !remove(pub) {
+			continue
+		}
+		delete(ap.pubs, p)
+		pub.removed = true
+		if pub.refs == 0 {
+			idle = append(idle, pub)
+		}
+	}
+	return idle
+}
+
+// updateActive sets whether the writes must go through publisherFor(), and starts or stops
+// the sweeping subroutine accordingly.
+// ap.mu must be locked by the caller.
+func (ap *autoPublishers) updateActive() {
+	if ap.threshold > 0 || len(ap.pubs) > 0 {
+		atomic.StoreInt32(&ap.active, 1)
+		if ap.stopSweep == nil {
+			ap.stopSweep = make(chan struct{})
+			go ap.sweepEvery(ap.window, ap.stopSweep)
+		}
+	} else {
+		atomic.StoreInt32(&ap.active, 0)
+		ap.stopSweeping()
+	}
+}
+
+// stopSweeping stops the sweeping subroutine, if it's running.
+// ap.mu must be locked by the caller.
+func (ap *autoPublishers) stopSweeping() {
+	if ap.stopSweep != nil {
+		close(ap.stopSweep)
+		ap.stopSweep = nil
+	}
+}
+
+// sweepEvery calls sweep() every window, until stop is closed.
+func (ap *autoPublishers) sweepEvery(window time.Duration, stop chan struct{}) {
+	ticker := time.NewTicker(window)
+	defer ticker.Stop()
+	for {
+		select {
+		case now := <-ticker.C:
+			ap.sweep(now)
+		case <-stop:
+			return
+		}
+	}
+}
@@ -0,0 +1,140 @@
+/*
+ * Copyright (c) 2017, 2020 ADLINK Technology Inc.
+ *
+ * This program and the accompanying materials are made available under the
+ * terms of the Eclipse Public License 2.0 which is available at
+ * http://www.eclipse.org/legal/epl-2.0, or the Apache License, Version 2.0
+ * which is available at https://www.apache.org/licenses/LICENSE-2.0.
+ *
+ * SPDX-License-Identifier: EPL-2.0 OR Apache-2.0
+ *
+ * Contributors:
+ *   ADLINK zenoh team, <zenoh@adlink-labs.tech>
+ */
+
+package zenoh
+
+import (
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	znet "github.com/eclipse-zenoh/zenoh-go/net"
+)
+
+// newTestAutoPublishers returns a Workspace with autoPublishers counting the declared
+// and undeclared publishers, instead of declaring them.
+func newTestAutoPublishers() (w *Workspace, declared *int32, undeclared *int32) {
+	declared, undeclared = new(int32), new(int32)
+	ap := newAutoPublishers(nil)
+	ap.declare = func(string) (*znet.Publisher, error) {
+		atomic.AddInt32(declared, 1)
+		return nil, nil
+	}
+	ap.undeclare = func(*znet.Publisher) error {
+		atomic.AddInt32(undeclared, 1)
+		return nil
+	}
+	return &Workspace{mu: new(sync.Mutex), autoPub: ap}, declared, undeclared
+}
+
+func TestPublisherClosed(t *testing.T) {
+	p, _ := NewPath("/test/a")
+	pub := &Publisher{p, &Workspace{mu: new(sync.Mutex)}, new(sync.RWMutex), nil, true}
+	if err := pub.Put(NewIntValue(1)); err == nil {
+		t.Error("Put() via a closed Publisher succeeded")
+	}
+	if err := pub.Close(); err != nil {
+		t.Errorf("Close() of a closed Publisher failed: %v", err)
+	}
+}
+
+func TestAutoPublishDisabled(t *testing.T) {
+	w, declared, _ := newTestAutoPublishers()
+	p, _ := NewPath("/test/a")
+	for i := 0; i < 10; i++ {
+		if pub := w.autoPub.publisherFor(p); pub != nil {
+			t.Fatal("publisher returned with auto-publish disabled")
+		}
+	}
+	if len(w.autoPub.counts) != 0 || *declared != 0 {
+		t.Errorf("writes counted with auto-publish disabled")
+	}
+}
+
+func TestAutoPublishThreshold(t *testing.T) {
+	w, declared, _ := newTestAutoPublishers()
+	w.SetAutoPublish(3, time.Hour)
+	defer w.autoPub.close()
+	p, _ := NewPath("/test/a")
+	for i := 1; i <= 3; i++ {
+		pub := w.autoPub.publisherFor(p)
+		if (pub != nil) != (i == 3) {
+			t.Fatalf("publisher returned for write %d: %v", i, pub != nil)
+		}
+		if pub != nil {
+			w.autoPub.release(pub)
+		}
+	}
+	pub := w.autoPub.publisherFor(p)
+	if pub == nil {
+		t.Fatal("no publisher returned after the threshold")
+	}
+	w.autoPub.release(pub)
+	if *declared != 1 {
+		t.Errorf("%d publishers declared", *declared)
+	}
+}
+
+func TestAutoPublishUndeclaresUnusedPublisher(t *testing.T) {
+	w, _, undeclared := newTestAutoPublishers()
+	w.SetAutoPublish(1, time.Hour)
+	p, _ := NewPath("/test/a")
+	pub := w.autoPub.publisherFor(p)
+	if pub == nil {
+		t.Fatal("no publisher returned")
+	}
+	// the publisher is idle, but still in use by a write
+	w.autoPub.sweep(time.Now().Add(2 * time.Hour))
+	if atomic.LoadInt32(undeclared) != 0 {
+		t.Fatal("publisher undeclared while in use")
+	}
+	w.autoPub.release(pub)
+	if atomic.LoadInt32(undeclared) != 1 {
+		t.Fatal("publisher not undeclared once released")
+	}
+
+	pub = w.autoPub.publisherFor(p)
+	if errs := w.autoPub.close(); len(errs) != 0 || atomic.LoadInt32(undeclared) != 1 {
+		t.Fatalf("publisher undeclared while in use by close(): %v", errs)
+	}
+	w.autoPub.release(pub)
+	if atomic.LoadInt32(undeclared) != 2 {
+		t.Error("publisher not undeclared once released after close()")
+	}
+	if w.autoPub.publisherFor(p) != nil {
+		t.Error("publisher returned after close()")
+	}
+}
+
+func TestAutoPublishSweepsWithoutWrites(t *testing.T) {
+	w, _, undeclared := newTestAutoPublishers()
+	w.SetAutoPublish(1, 10*time.Millisecond)
+	p, _ := NewPath("/test/a")
+	w.autoPub.release(w.autoPub.publisherFor(p))
+	w.SetAutoPublish(0, 10*time.Millisecond)
+
+	deadline := time.Now().Add(5 * time.Second)
+	for atomic.LoadInt32(undeclared) == 0 || atomic.LoadInt32(&w.autoPub.active) != 0 {
+		if time.Now().After(deadline) {
+			t.Fatal("idle publisher not undeclared")
+		}
+		time.Sleep(time.Millisecond)
+	}
+	w.autoPub.mu.Lock()
+	defer w.autoPub.mu.Unlock()
+	if w.autoPub.stopSweep != nil {
+		t.Error("sweeping still running with no publisher and auto-publish disabled")
+	}
+}
@@ -0,0 +1,313 @@
+/*
+ * Copyright (c) 2017, 2020 ADLINK Technology Inc.
+ *
+ * This program and the accompanying materials are made available under the
+ * terms of the Eclipse Public License 2.0 which is available at
+ * http://www.eclipse.org/legal/epl-2.0, or the Apache License, Version 2.0
+ * which is available at https://www.apache.org/licenses/LICENSE-2.0.
+ *
+ * SPDX-License-Identifier: EPL-2.0 OR Apache-2.0
+ *
+ * Contributors:
+ *   ADLINK zenoh team, <zenoh@adlink-labs.tech>
+ */
+
+package zenoh
+
+import (
+	"sync"
+	"time"
+
+	log "github.com/sirupsen/logrus"
+)
+
+// Default values for StorageOptions
+const (
+	defaultRetentionInterval = time.Minute
+)
+
+// StorageOptions configures a storage (see Workspace.RegisterStorageWithOptions()).
+type StorageOptions struct {
+	// Retention are the retention rules of the storage. For each path, the first matching rule applies.
+	Retention []RetentionRule
+
+	// RetentionInterval is the interval between two applications of the retention rules.
+	// If 0, a default interval of 1 minute is used.
+	RetentionInterval time.Duration
+}
+
+// RetentionRule specifies when the path/values stored by a storage expire.
+// An expired path is removed from the StorageBackend.
+type RetentionRule struct {
+	// Expr selects the paths the rule applies to. If relative, it's relative to the Workspace's path.
+	Expr *PathExpr
+
+	// MaxAge is the maximum age of a value (according to its Timestamp). If 0, there is no limit.
+	// For a StorageBackend implementing SampleEvicter, it also applies to the older samples of the paths.
+	MaxAge time.Duration
+
+	// MaxSamples is the maximum number of samples kept per path, for a StorageBackend
+	// implementing SampleEvicter. If 0, there is no limit.
+	MaxSamples int
+
+	// ExpireAfterLastWrite is the duration after the last write (as received by the storage)
+	// at which a path expires. If 0, there is no limit.
+	ExpireAfterLastWrite time.Duration
+
+	// AnnounceRemoval makes the removal of the expired paths published as REMOVE changes.
+	AnnounceRemoval bool
+
+	// OnEvict, if set, is called after each application of the rule with its statistics.
+	OnEvict func(stats RetentionStats)
+}
+
+// RetentionStats are the statistics of an application of a RetentionRule.
+type RetentionStats struct {
+	// Rule is the applied RetentionRule (with an absolute Expr).
+	Rule *RetentionRule
+	// EvictedPaths is the number of expired paths removed.
+	EvictedPaths int
+	// EvictedSamples is the number of samples dropped from the paths that didn't expire.
+	EvictedSamples int
+}
+
+// SampleEvicter is implemented by the StorageBackends keeping several samples per path
+// (e.g. HistoryBackend), for the retention rules to apply to these samples.
+// Such backends also receive the changes older than the latest one of their path
+// (e.g. received out of order), which the other backends don't.
+type SampleEvicter interface {
+	// EvictSamples drops the samples of the path with a Timestamp before the time before (if not zero),
+	// and the oldest samples exceeding maxSamples (if greater than 0). The latest sample must be kept.
+	// It returns the number of dropped samples.
+	EvictSamples(path *Path, before time.Time, maxSamples int) (int, error)
+
+	// SampledPaths returns the paths having samples, including the removed ones.
+	SampledPaths() ([]*Path, error)
+}
+
+// retention applies the retention rules of a storage.
+type retention struct {
+	rules    []RetentionRule
+	interval time.Duration
+	stopc    chan struct{}
+	done     chan struct{}
+}
+
+func newRetention(w *Workspace, opts *StorageOptions) (*retention, error) {
+	r := &retention{rules: make([]RetentionRule, len(opts.Retention)), interval: opts.RetentionInterval,
+		stopc: make(chan struct{}), done: make(chan struct{})}
+	if r.interval <= 0 {
+		r.interval = defaultRetentionInterval
+	}
+	for i, rule := range opts.Retention {
+		if rule.Expr == nil {
+			return nil, &ZError{Msg: "Invalid retention rule (no Expr)", Code: 0, Cause: nil}
+		}
+		r.rules[i] = rule
+		r.rules[i].Expr = w.toAbsolutePathExpr(rule.Expr)
+	}
+	return r, nil
+}
+
+func (r *retention) run(sh *storageHandler) {
+	defer close(r.done)
+	ticker := time.NewTicker(r.interval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ticker.C:
+			r.apply(sh, time.Now())
+		case <-r.stopc:
+			return
+		}
+	}
+}
+
+func (r *retention) stop() {
+	select {
+	case <-r.stopc:
+	default:
+		close(r.stopc)
+	}
+	<-r.done
+}
+
+// ruleFor returns the index of the first rule matching the Path p, or -1.
+func (r *retention) ruleFor(p *Path) int {
+	for i := range r.rules {
+		if ok, _ := r.rules[i].Expr.Match(p); ok {
+			return i
+		}
+	}
+	return -1
+}
+
+// apply applies the retention rules to the path/values stored by the storage.
+// For each path, the rule is applied by a task run as the changes of the path are stored
+// (see storageHandler.run()), so that it's not concurrent with them.
+func (r *retention) apply(sh *storageHandler, now time.Time) {
+	// the storage's backend is queried for the latest values of its whole selection
+	all, _ := NewSelector(sh.s.Path())
+	stored, err := sh.backend.Query(all)
+	if err != nil {
+		sh.logger.WithField("error", err).Warn("Storage failed to apply retention rules")
+		return
+	}
+	// the latest value of each path, or nil for the removed paths with samples
+	latest := make(map[Path]*StoredData, len(stored))
+	for i := range stored {
+		latest[*stored[i].Path] = &stored[i]
+	}
+	if evicter, ok := sh.backend.(SampleEvicter); ok {
+		paths, err := evicter.SampledPaths()
+		if err != nil {
+			sh.logger.WithField("error", err).Warn("Storage failed to list the paths with samples")
+		}
+		for _, p := range paths {
+			if _, ok := latest[*p]; !ok {
+				latest[*p] = nil
+			}
+		}
+	}
+
+	stats := make([]RetentionStats, len(r.rules))
+	var mu sync.Mutex
+	var wg sync.WaitGroup
+	for p, sd := range latest {
+		p, sd := p, sd
+		i := r.ruleFor(&p)
+		if i < 0 {
+			continue
+		}
+		wg.Add(1)
+		ok := sh.run(p.ToString(), func() {
+			defer wg.Done()
+			evictedPaths, evictedSamples := r.applyRule(sh, &r.rules[i], &p, sd, now)
+			mu.Lock()
+			stats[i].EvictedPaths += evictedPaths
+			stats[i].EvictedSamples += evictedSamples
+			mu.Unlock()
+		})
+		if !ok {
+			wg.Done()
+			sh.logger.WithField("path", p).Debug("Storage : retention dropped by executor (full or shut down)")
+		}
+	}
+	// the storage can be unregistered while the tasks are queued in the executor
+	finished := make(chan struct{})
+	go func() {
+		wg.Wait()
+		close(finished)
+	}()
+	select {
+	case <-finished:
+	case <-r.stopc:
+		return
+	}
+	r.pruneLatest(sh, now)
+	for i := range r.rules {
+		if r.rules[i].OnEvict != nil {
+			stats[i].Rule = &r.rules[i]
+			r.rules[i].OnEvict(stats[i])
+		}
+	}
+}
+
+// applyRule applies the rule to the Path p with the latest stored path/value sd (nil if p is removed),
+// and returns the number of evicted paths (0 or 1) and samples.
+func (r *retention) applyRule(sh *storageHandler, rule *RetentionRule, p *Path, sd *StoredData, now time.Time) (int, int) {
+	if sd != nil && r.isExpired(sh, rule, sd, now) {
+		evicted, err := r.evict(sh, rule, p)
+		if err != nil {
+			sh.logger.WithFields(log.Fields{
+				"path":  p,
+				"error": err,
+			}).Warn("Storage failed to remove expired path")
+		}
+		if evicted {
+			return 1, 0
+		}
+		return 0, 0
+	}
+	evicter, isEvicter := sh.backend.(SampleEvicter)
+	if !isEvicter || (rule.MaxAge <= 0 && rule.MaxSamples <= 0) {
+		return 0, 0
+	}
+	var before time.Time
+	if rule.MaxAge > 0 {
+		before = now.Add(-rule.MaxAge)
+	}
+	n, err := evicter.EvictSamples(p, before, rule.MaxSamples)
+	if err != nil {
+		sh.logger.WithFields(log.Fields{
+			"path":  p,
+			"error": err,
+		}).Warn("Storage failed to evict samples")
+	}
+	return 0, n
+}
+
+// pruneLatest drops the latest Timestamps of the removed paths which are older than the MaxAge
+// of their rule: as a change older than that expires anyway, it no longer needs to be dropped.
+func (r *retention) pruneLatest(sh *storageHandler, now time.Time) {
+	sh.mu.Lock()
+	defer sh.mu.Unlock()
+	for p, ts := range sh.latest {
+		if _, written := sh.lastWrite[p]; written {
+			continue
+		}
+		p, ts := p, ts
+		if i := r.ruleFor(&p); i >= 0 && r.rules[i].MaxAge > 0 && now.Sub(ts.GoTime()) > r.rules[i].MaxAge {
+			delete(sh.latest, p)
+		}
+	}
+}
+
+// isExpired returns true if the stored path/value sd expired according to the rule.
+// It returns false if the path changed since sd has been read.
+func (r *retention) isExpired(sh *storageHandler, rule *RetentionRule, sd *StoredData, now time.Time) bool {
+	sh.mu.Lock()
+	latest, hasLatest := sh.latest[*sd.Path]
+	lastWrite, hasLastWrite := sh.lastWrite[*sd.Path]
+	sh.mu.Unlock()
+	if hasLatest && sd.Timestamp != nil && sd.Timestamp.Before(&latest) {
+		return false
+	}
+
+	var written time.Time
+	if sd.Timestamp != nil {
+		written = sd.Timestamp.GoTime()
+	}
+	if rule.MaxAge > 0 && sd.Timestamp != nil && now.Sub(written) > rule.MaxAge {
+		return true
+	}
+	if rule.ExpireAfterLastWrite > 0 {
+		if hasLastWrite {
+			written = lastWrite
+		}
+		if !written.IsZero() && now.Sub(written) > rule.ExpireAfterLastWrite {
+			return true
+		}
+	}
+	return false
+}
+
+// evict removes an expired path from the storage's backend, and announces its removal if required.
+// It returns false if the path has not been removed (e.g. written meanwhile).
+func (r *retention) evict(sh *storageHandler, rule *RetentionRule, p *Path) (bool, error) {
+	ts := sh.w.z.clock.newTimestamp()
+	if !sh.isLatest(p, ts) {
+		return false, nil
+	}
+	sh.forget(p)
+	if err := sh.backend.Remove(p, ts); err != nil {
+		return false, err
+	}
+	sh.logger.WithField("path", p).Debug("Storage removed expired path")
+	if rule.AnnounceRemoval {
+		if err := sh.w.session.WriteDataWO(p.ToString(), nil, 0, REMOVE); err != nil {
+			return true, &ZError{Msg: "Announce of removal of " + p.ToString() + " failed", Code: 0, Cause: err}
+		}
+	}
+	return true, nil
+}
@@ -0,0 +1,160 @@
+/*
+ * Copyright (c) 2017, 2020 ADLINK Technology Inc.
+ *
+ * This program and the accompanying materials are made available under the
+ * terms of the Eclipse Public License 2.0 which is available at
+ * http://www.eclipse.org/legal/epl-2.0, or the Apache License, Version 2.0
+ * which is available at https://www.apache.org/licenses/LICENSE-2.0.
+ *
+ * SPDX-License-Identifier: EPL-2.0 OR Apache-2.0
+ *
+ * Contributors:
+ *   ADLINK zenoh team, <zenoh@adlink-labs.tech>
+ */
+
+package zenoh
+
+import (
+	"testing"
+	"time"
+)
+
+// newTestStorage returns a storageHandler for a HistoryBackend storing /test/**, with the retention rules.
+func newTestStorage(t *testing.T, rules ...RetentionRule) *storageHandler {
+	root, _ := NewPath("/")
+	w := newWorkspace(&Zenoh{clock: newHLC([]byte{2})}, root, nil)
+	s, _ := NewSelector("/test/**")
+	sh := newStorageHandler(w, s, NewHistoryBackend(nil))
+	var err error
+	if sh.retention, err = newRetention(w, &StorageOptions{Retention: rules}); err != nil {
+		t.Fatal(err)
+	}
+	return sh
+}
+
+// storeAt stores the value v for the path p as received at time at.
+func storeAt(sh *storageHandler, p *Path, v Value, at time.Time) {
+	ts := testTimestamp(ntp64(at))
+	if sh.isLatest(p, ts) {
+		sh.store(PUT, p, v, ts)
+	}
+}
+
+func TestHLC(t *testing.T) {
+	c := newHLC([]byte{1, 2})
+	t1 := c.newTimestamp()
+	t2 := c.newTimestamp()
+	if !t1.Before(t2) {
+		t.Errorf("%d not before %d", t1.Time(), t2.Time())
+	}
+	if d := time.Since(t1.GoTime()); d < 0 || d > time.Minute {
+		t.Errorf("Timestamp time %v is not now", t1.GoTime())
+	}
+	future := testTimestamp(ntp64(time.Now().Add(time.Hour)))
+	c.update(future)
+	if t3 := c.newTimestamp(); !future.Before(t3) {
+		t.Errorf("%d not after the received %d", t3.Time(), future.Time())
+	}
+	if clk := t1.ClockID(); clk[0] != 1 || clk[1] != 2 {
+		t.Errorf("clock id %v", clk)
+	}
+}
+
+func TestRetentionMaxAge(t *testing.T) {
+	expr, _ := NewPathExpr("/test/**")
+	var stats RetentionStats
+	sh := newTestStorage(t, RetentionRule{Expr: expr, MaxAge: time.Hour, OnEvict: func(s RetentionStats) { stats = s }})
+	a, _ := NewPath("/test/a")
+	b, _ := NewPath("/test/b")
+	now := time.Now()
+	storeAt(sh, a, NewIntValue(1), now.Add(-2*time.Hour))
+	storeAt(sh, b, NewIntValue(2), now)
+
+	sh.retention.apply(sh, now)
+	if stats.EvictedPaths != 1 {
+		t.Errorf("%d paths evicted, expected 1", stats.EvictedPaths)
+	}
+	if values := queryPaths(t, sh.backend, "/test/**"); len(values) != 1 || values["/test/b"] != "2" {
+		t.Errorf("values after retention %v", values)
+	}
+	if _, ok := sh.lastWrite[*a]; ok {
+		t.Error("last write of the evicted path not dropped")
+	}
+	// a change older than the eviction is dropped
+	if sh.isLatest(a, testTimestamp(ntp64(now.Add(-time.Minute)))) {
+		t.Error("change older than the eviction accepted")
+	}
+}
+
+func TestRetentionExpireAfterLastWrite(t *testing.T) {
+	expr, _ := NewPathExpr("/test/**")
+	sh := newTestStorage(t, RetentionRule{Expr: expr, ExpireAfterLastWrite: time.Minute})
+	a, _ := NewPath("/test/a")
+	now := time.Now()
+	storeAt(sh, a, NewIntValue(1), now)
+
+	sh.retention.apply(sh, now.Add(30*time.Second))
+	if values := queryPaths(t, sh.backend, "/test/**"); len(values) != 1 {
+		t.Errorf("values after retention %v, expected /test/a", values)
+	}
+	sh.retention.apply(sh, now.Add(2*time.Minute))
+	if values := queryPaths(t, sh.backend, "/test/**"); len(values) != 0 {
+		t.Errorf("values after retention %v, expected none", values)
+	}
+}
+
+func TestRetentionSkipsChangedPath(t *testing.T) {
+	expr, _ := NewPathExpr("/test/**")
+	sh := newTestStorage(t, RetentionRule{Expr: expr, MaxAge: time.Hour})
+	a, _ := NewPath("/test/a")
+	now := time.Now()
+	old := testTimestamp(ntp64(now.Add(-2 * time.Hour)))
+	// the path has been written since it was read by the retention
+	storeAt(sh, a, NewIntValue(1), now)
+	if sh.retention.isExpired(sh, &sh.retention.rules[0], &StoredData{a, NewIntValue(0), old}, now) {
+		t.Error("path written after its expired value was read is expired")
+	}
+}
+
+func TestRetentionRemovedPath(t *testing.T) {
+	expr, _ := NewPathExpr("/test/**")
+	var stats RetentionStats
+	sh := newTestStorage(t, RetentionRule{Expr: expr, MaxAge: time.Hour, OnEvict: func(s RetentionStats) { stats = s }})
+	a, _ := NewPath("/test/a")
+	now := time.Now()
+	storeAt(sh, a, NewIntValue(1), now.Add(-3*time.Hour))
+	storeAt(sh, a, NewIntValue(2), now.Add(-2*time.Hour))
+	sh.storeChange(REMOVE, a, nil, testTimestamp(ntp64(now.Add(-90*time.Minute))))
+
+	sh.retention.apply(sh, now)
+	// the removal is kept as latest sample
+	if stats.EvictedSamples != 2 {
+		t.Errorf("%d samples evicted from the removed path, expected 2", stats.EvictedSamples)
+	}
+	if _, ok := sh.latest[*a]; ok {
+		t.Error("latest Timestamp of the path removed before the MaxAge not pruned")
+	}
+}
+
+func TestRetentionStop(t *testing.T) {
+	expr, _ := NewPathExpr("/test/**")
+	sh := newTestStorage(t, RetentionRule{Expr: expr, MaxAge: time.Hour})
+	a, _ := NewPath("/test/a")
+	storeAt(sh, a, NewIntValue(1), time.Now())
+	sh.w.executor = newExecutor(&ExecutorOptions{Workers: 1})
+	release := blockWorker(t, sh.w.executor, "/test/a")
+	defer sh.w.executor.shutdown()
+	defer close(release)
+
+	applied := make(chan struct{})
+	go func() {
+		sh.retention.apply(sh, time.Now())
+		close(applied)
+	}()
+	close(sh.retention.stopc)
+	select {
+	case <-applied:
+	case <-time.After(5 * time.Second):
+		t.Fatal("retention waiting for the executor after being stopped")
+	}
+}
@@ -0,0 +1,299 @@
+/*
+ * Copyright (c) 2017, 2020 ADLINK Technology Inc.
+ *
+ * This program and the accompanying materials are made available under the
+ * terms of the Eclipse Public License 2.0 which is available at
+ * http://www.eclipse.org/legal/epl-2.0, or the Apache License, Version 2.0
+ * which is available at https://www.apache.org/licenses/LICENSE-2.0.
+ *
+ * SPDX-License-Identifier: EPL-2.0 OR Apache-2.0
+ *
+ * Contributors:
+ *   ADLINK zenoh team, <zenoh@adlink-labs.tech>
+ */
+
+package zenoh
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"encoding/base64"
+	"encoding/hex"
+	"encoding/json"
+	"io"
+	"sort"
+	"strconv"
+
+	zcore "github.com/eclipse-zenoh/zenoh-go/core"
+)
+
+// snapshotFormat identifies the header record of a snapshot.
+const (
+	snapshotFormat  = "zenoh-snapshot"
+	snapshotVersion = 1
+)
+
+var encodingNames = map[Encoding]string{
+	RAW:        "RAW",
+	STRING:     "STRING",
+	PROPERTIES: "PROPERTIES",
+	JSON:       "JSON",
+	INT:        "INT",
+	FLOAT:      "FLOAT",
+}
+
+var kindNames = map[ChangeKind]string{
+	PUT:    "PUT",
+	UPDATE: "UPDATE",
+	REMOVE: "REMOVE",
+}
+
+// snapshotRecord is a line of a snapshot. The header record only has Format, Version and Selector.
+type snapshotRecord struct {
+	Format    string             `json:"format,omitempty"`
+	Version   int                `json:"version,omitempty"`
+	Selector  string             `json:"selector,omitempty"`
+	Path      string             `json:"path,omitempty"`
+	Encoding  string             `json:"encoding,omitempty"`
+	Kind      string             `json:"kind,omitempty"`
+	Timestamp *snapshotTimestamp `json:"timestamp,omitempty"`
+	Value     string             `json:"value,omitempty"`
+}
+
+// snapshotTimestamp is a Timestamp in a snapshot: its time as a 64-bit NTP time
+// (see Timestamp.Time()) and its clock id in hexadecimal.
+type snapshotTimestamp struct {
+	Time    uint64 `json:"time"`
+	ClockID string `json:"clock_id"`
+}
+
+// ImportFailure is a record of a snapshot that couldn't be imported.
+type ImportFailure struct {
+	// Line is the line number of the record in the snapshot (starting at 1).
+	Line int
+	// Path is the path of the record, if it could be decoded.
+	Path string
+	// Err is the cause of the failure.
+	Err error
+}
+
+// ImportReport is the result of Workspace.Import().
+type ImportReport struct {
+	// Imported is the number of imported records.
+	Imported int
+	// Failures are the records that couldn't be imported.
+	Failures []ImportFailure
+}
+
+// Export writes a snapshot of a selection of path/value to out, as returned by Get(), in a
+// line-delimited JSON format. The first line is a header identifying the format. Each of the
+// other lines is a record with the path, the encoding, the kind, the Timestamp and the value
+// (encoded in base64) of a path/value.
+func (w *Workspace) Export(selector *Selector, out io.Writer) error {
+	s := w.toAbsoluteSelector(selector)
+	logger.WithField("selector", s).Debug("Export")
+	// the errors of the evals are not exported
+	data, _, err := w.getWithEvalErrors(context.Background(), s, nil)
+	if err != nil {
+		return &ZError{Msg: "Export of " + s.ToString() + " failed", Code: 0, Cause: err}
+	}
+	sort.SliceStable(data, func(i, j int) bool {
+		if pi, pj := data[i].Path().ToString(), data[j].Path().ToString(); pi != pj {
+			return pi < pj
+		}
+		return data[i].Timestamp().Before(data[j].Timestamp())
+	})
+	if err := writeSnapshot(out, s, data); err != nil {
+		return &ZError{Msg: "Export of " + s.ToString() + " failed", Code: 0, Cause: err}
+	}
+	return nil
+}
+
+// writeSnapshot writes the snapshot of the path/values data, selected by s, to out.
+func writeSnapshot(out io.Writer, s *Selector, data []Data) error {
+	bw := bufio.NewWriter(out)
+	enc := json.NewEncoder(bw)
+	if err := enc.Encode(&snapshotRecord{Format: snapshotFormat, Version: snapshotVersion, Selector: s.ToString()}); err != nil {
+		return err
+	}
+	for _, d := range data {
+		clk := d.Timestamp().ClockID()
+		rec := &snapshotRecord{
+			Path:      d.Path().ToString(),
+			Encoding:  encodingName(d.Value().Encoding()),
+			Kind:      kindNames[PUT],
+			Timestamp: &snapshotTimestamp{d.Timestamp().Time(), hex.EncodeToString(clk[:])},
+			Value:     base64.StdEncoding.EncodeToString(d.Value().Encode()),
+		}
+		if err := enc.Encode(rec); err != nil {
+			return err
+		}
+	}
+	return bw.Flush()
+}
+
+// Import reads a snapshot written by Export() from in, and puts, updates or removes
+// each of its records into Zenoh.
+//
+// As zenoh-net doesn't allow to publish a value with a Timestamp, the records are published
+// with a new Timestamp. Before, the records which path is stored by a storage registered via
+// this Workspace (see RegisterStorage()) are directly stored with their original Timestamp
+// (as the changes received by the storage are), for a storage keeping a history (such as
+// a HistoryBackend) to keep them at their original time.
+// As it waits for the records to be stored, Import must not be called by a listener or an eval
+// if the Workspace has an executor.
+//
+// The records that can't be imported are reported in the returned ImportReport, and
+// the import goes on. An error is returned only if the snapshot can't be read.
+func (w *Workspace) Import(in io.Reader) (*ImportReport, error) {
+	logger.WithField("path", w.path).Debug("Import")
+	report := &ImportReport{Failures: make([]ImportFailure, 0)}
+	storages := w.localStorages()
+	br := bufio.NewReader(in)
+	for line := 1; ; line++ {
+		buf, err := br.ReadBytes('\n')
+		if len(buf) > 0 {
+			if path, e := w.importRecord(buf, storages); e != nil {
+				report.Failures = append(report.Failures, ImportFailure{line, path, e})
+			} else if path != "" {
+				report.Imported++
+			}
+		}
+		if err == io.EOF {
+			return report, nil
+		} else if err != nil {
+			return report, &ZError{Msg: "Import failed at line " + strconv.Itoa(line), Code: 0, Cause: err}
+		}
+	}
+}
+
+// importRecord imports a line of a snapshot, and returns the path of the record
+// (empty for the header and blank lines). The storages are the storages registered via the Workspace.
+func (w *Workspace) importRecord(line []byte, storages []localStorage) (string, error) {
+	var rec snapshotRecord
+	if len(bytes.TrimSpace(line)) == 0 {
+		return "", nil
+	}
+	if err := json.Unmarshal(line, &rec); err != nil {
+		return "", &ZError{Msg: "Invalid record", Code: 0, Cause: err}
+	}
+	if rec.Format != "" {
+		if rec.Format != snapshotFormat || rec.Version > snapshotVersion {
+			return "", &ZError{Msg: "Unsupported snapshot format " + rec.Format + " version " + strconv.Itoa(rec.Version), Code: 0, Cause: nil}
+		}
+		return "", nil
+	}
+
+	path, err := NewPath(rec.Path)
+	if err != nil {
+		return rec.Path, err
+	}
+	p := w.toAbsolutePath(path)
+	kind, ok := kindOfName(rec.Kind)
+	if !ok {
+		return rec.Path, &ZError{Msg: "Invalid kind " + rec.Kind, Code: 0, Cause: nil}
+	}
+	var value Value
+	if kind != REMOVE {
+		if value, err = decodeSnapshotValue(&rec); err != nil {
+			return rec.Path, err
+		}
+	}
+	var ts *Timestamp
+	if rec.Timestamp != nil {
+		clk, err := hex.DecodeString(rec.Timestamp.ClockID)
+		if err != nil || len(clk) != 16 {
+			return rec.Path, &ZError{Msg: "Invalid Timestamp clock id " + rec.Timestamp.ClockID, Code: 0, Cause: err}
+		}
+		var id [16]byte
+		copy(id[:], clk)
+		ts = zcore.NewTimestamp(rec.Timestamp.Time, id)
+	}
+
+	var storeErr error
+	if ts != nil {
+		for _, ls := range storages {
+			if ls.match(p) {
+				if err := ls.sh.storeAndWait(kind, p, value, ts); err != nil && storeErr == nil {
+					storeErr = err
+				}
+			}
+		}
+	}
+	switch kind {
+	case REMOVE:
+		err = w.Remove(p)
+	case UPDATE:
+		err = w.Update(p, value)
+	default:
+		err = w.Put(p, value)
+	}
+	if err == nil {
+		err = storeErr
+	}
+	return rec.Path, err
+}
+
+// localStorage is a storage registered via a Workspace, with the matcher of its selection.
+type localStorage struct {
+	match func(*Path) bool
+	sh    *storageHandler
+}
+
+// localStorages returns the storages registered via the Workspace.
+func (w *Workspace) localStorages() []localStorage {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	result := make([]localStorage, 0, len(w.storages))
+	for expr, rs := range w.storages {
+		result = append(result, localStorage{rnameMatcher(expr), rs.sh})
+	}
+	return result
+}
+
+func decodeSnapshotValue(rec *snapshotRecord) (Value, error) {
+	encoding, ok := encodingOfName(rec.Encoding)
+	if !ok {
+		return nil, &ZError{Msg: "Invalid encoding " + rec.Encoding, Code: 0, Cause: nil}
+	}
+	payload, err := base64.StdEncoding.DecodeString(rec.Value)
+	if err != nil {
+		return nil, &ZError{Msg: "Invalid base64 value", Code: 0, Cause: err}
+	}
+	decoder, ok := valueDecoders[encoding]
+	if !ok {
+		return nil, &ZError{Msg: "No Decoder found for encoding " + rec.Encoding, Code: 0, Cause: nil}
+	}
+	return decoder(payload)
+}
+
+// encodingName returns the name of an Encoding, or its number if it has no name.
+func encodingName(e Encoding) string {
+	if name, ok := encodingNames[e]; ok {
+		return name
+	}
+	return strconv.Itoa(int(e))
+}
+
+func encodingOfName(name string) (Encoding, bool) {
+	for e, n := range encodingNames {
+		if n == name {
+			return e, true
+		}
+	}
+	i, err := strconv.ParseUint(name, 10, 8)
+	return Encoding(i), err == nil
+}
+
+func kindOfName(name string) (ChangeKind, bool) {
+	if name == "" {
+		return PUT, true
+	}
+	for k, n := range kindNames {
+		if n == name {
+			return k, true
+		}
+	}
+	return PUT, false
+}
@@ -0,0 +1,129 @@
+/*
+ * Copyright (c) 2017, 2020 ADLINK Technology Inc.
+ *
+ * This program and the accompanying materials are made available under the
+ * terms of the Eclipse Public License 2.0 which is available at
+ * http://www.eclipse.org/legal/epl-2.0, or the Apache License, Version 2.0
+ * which is available at https://www.apache.org/licenses/LICENSE-2.0.
+ *
+ * SPDX-License-Identifier: EPL-2.0 OR Apache-2.0
+ *
+ * Contributors:
+ *   ADLINK zenoh team, <zenoh@adlink-labs.tech>
+ */
+
+package zenoh
+
+import (
+	"bytes"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+// newTestStorageWorkspace returns a Workspace with a storage registered for /test/**, without session.
+// Its writes are not published, but recorded as "<operation> <path>".
+func newTestStorageWorkspace() (*Workspace, *HistoryBackend, *[]string) {
+	root, _ := NewPath("/")
+	w := newWorkspace(&Zenoh{clock: newHLC([]byte{2})}, root, nil)
+	s, _ := NewSelector("/test/**")
+	backend := NewHistoryBackend(nil)
+	w.storages[s.Path()] = &registeredStorage{nil, newStorageHandler(w, s, backend)}
+	published := make([]string, 0)
+	w.Use(func(inv *Invocation, next Handler) error {
+		published = append(published, inv.Op.ToString()+" "+inv.Target)
+		return nil
+	})
+	return w, backend, &published
+}
+
+func TestSnapshotRoundTrip(t *testing.T) {
+	pa, _ := NewPath("/test/a")
+	pb, _ := NewPath("/test/b/c")
+	data := []Data{
+		{path: pa, value: NewStringValue("hello"), tstamp: testTimestamp(10)},
+		{path: pb, value: NewIntValue(42), tstamp: testTimestamp(20)},
+		{path: pb, value: &JSONValue{[]byte(`{"x":1}`)}, tstamp: testTimestamp(30)},
+		{path: pa, value: NewRawValue([]byte{0, 1, 0xff}), tstamp: testTimestamp(5)},
+	}
+	s, _ := NewSelector("/test/**")
+	var buf bytes.Buffer
+	if err := writeSnapshot(&buf, s, data); err != nil {
+		t.Fatalf("writeSnapshot() failed: %v", err)
+	}
+
+	w, backend, published := newTestStorageWorkspace()
+	report, err := w.Import(&buf)
+	if err != nil {
+		t.Fatalf("Import() failed: %v", err)
+	}
+	if report.Imported != len(data) || len(report.Failures) != 0 {
+		t.Errorf("Import() = %+v, expected %d records imported", report, len(data))
+	}
+	// the records are published, even if stored by a local storage
+	if len(*published) != len(data) || (*published)[0] != "Put /test/a" {
+		t.Errorf("published %v, expected the %d records", *published, len(data))
+	}
+	// the local storage keeps the older record of /test/a in its history
+	if n := len(backend.series[*pa].samples); n != 2 {
+		t.Errorf("%d samples stored for /test/a, expected 2", n)
+	}
+	stored, _ := backend.Query(s)
+	values := make(map[string]StoredData)
+	for _, sd := range stored {
+		values[sd.Path.ToString()] = sd
+	}
+	// the older record of /test/a is not the latest value
+	if sd, ok := values["/test/a"]; !ok || sd.Value.ToString() != "hello" || sd.Timestamp.Time() != 10 {
+		t.Errorf("/test/a imported as %+v", sd)
+	}
+	if sd, ok := values["/test/b/c"]; !ok || sd.Value.ToString() != `{"x":1}` || sd.Timestamp.Time() != 30 || sd.Timestamp.ClockID() != testTimestamp(0).ClockID() {
+		t.Errorf("/test/b/c imported as %+v", sd)
+	}
+	if _, ok := values["/test/b/c"].Value.(*JSONValue); !ok {
+		t.Errorf("/test/b/c imported as %T, expected *JSONValue", values["/test/b/c"].Value)
+	}
+}
+
+func TestImportMalformedRecords(t *testing.T) {
+	clk := `"clock_id":"01000000000000000000000000000000"`
+	snapshot := strings.Join([]string{
+		`{"format":"zenoh-snapshot","version":1,"selector":"/test/**"}`,
+		`{"path":"/test/a","encoding":"STRING","kind":"PUT","timestamp":{"time":1,` + clk + `},"value":"aGVsbG8="}`,
+		``,
+		`not json`,
+		`{"path":"/test/b","encoding":"BOGUS","kind":"PUT","timestamp":{"time":1,` + clk + `},"value":"aGVsbG8="}`,
+		`{"path":"/test/b","encoding":"STRING","kind":"MOVE","timestamp":{"time":1,` + clk + `},"value":"aGVsbG8="}`,
+		`{"path":"/test/b","encoding":"STRING","kind":"PUT","timestamp":{"time":1,` + clk + `},"value":"!!"}`,
+		`{"path":"/test/b","encoding":"INT","kind":"PUT","timestamp":{"time":1,` + clk + `},"value":"aGVsbG8="}`,
+		`{"path":"/test/b","encoding":"STRING","kind":"PUT","timestamp":{"time":1,"clock_id":"0g"},"value":"aGVsbG8="}`,
+		`{"path":"/test/*","encoding":"STRING","kind":"PUT","timestamp":{"time":1,` + clk + `},"value":"aGVsbG8="}`,
+		`{"path":"/test/a","kind":"REMOVE","timestamp":{"time":2,` + clk + `}}`,
+	}, "\n")
+	w, backend, published := newTestStorageWorkspace()
+	report, err := w.Import(strings.NewReader(snapshot))
+	if err != nil {
+		t.Fatalf("Import() failed: %v", err)
+	}
+	if report.Imported != 2 {
+		t.Errorf("%d records imported, expected 2", report.Imported)
+	}
+	lines := make([]int, len(report.Failures))
+	for i, f := range report.Failures {
+		lines[i] = f.Line
+	}
+	if expected := []int{4, 5, 6, 7, 8, 9, 10}; !reflect.DeepEqual(lines, expected) {
+		t.Errorf("failures at lines %v, expected %v", lines, expected)
+	}
+	if values := queryPaths(t, backend, "/test/**"); len(values) != 0 {
+		t.Errorf("values after import %v, expected none", values)
+	}
+	if expected := []string{"Put /test/a", "Remove /test/a"}; !reflect.DeepEqual(*published, expected) {
+		t.Errorf("published %v, expected %v", *published, expected)
+	}
+
+	report, err = w.Import(strings.NewReader(`{"format":"zenoh-snapshot","version":99}`))
+	if err != nil || len(report.Failures) != 1 {
+		t.Errorf("Import() of an unsupported version = %+v, %v", report, err)
+	}
+}
@@ -0,0 +1,386 @@
+/*
+ * Copyright (c) 2017, 2020 ADLINK Technology Inc.
+ *
+ * This program and the accompanying materials are made available under the
+ * terms of the Eclipse Public License 2.0 which is available at
+ * http://www.eclipse.org/legal/epl-2.0, or the Apache License, Version 2.0
+ * which is available at https://www.apache.org/licenses/LICENSE-2.0.
+ *
+ * SPDX-License-Identifier: EPL-2.0 OR Apache-2.0
+ *
+ * Contributors:
+ *   ADLINK zenoh team, <zenoh@adlink-labs.tech>
+ */
+
+package zenoh
+
+import (
+	"encoding/binary"
+	"sync"
+	"time"
+
+	zcore "github.com/eclipse-zenoh/zenoh-go/core"
+	znet "github.com/eclipse-zenoh/zenoh-go/net"
+	log "github.com/sirupsen/logrus"
+)
+
+// StoredData is a path/value stored by a StorageBackend, with its Timestamp.
+type StoredData struct {
+	Path      *Path
+	Value     Value
+	Timestamp *Timestamp
+}
+
+// StorageBackend stores the path/values of a storage registered via Workspace.RegisterStorage().
+//
+// Its operations are called with absolute Paths, decoded Values and non-nil Timestamps.
+// The Workspace calls them in Timestamp order for each Path: the changes older than the last
+// change received for the same Path since the registration are not passed to the StorageBackend.
+// The operations for a same Path are not called concurrently.
+type StorageBackend interface {
+	// Put stores the value for the path, replacing the existing one.
+	Put(path *Path, value Value, ts *Timestamp) error
+
+	// Update updates the value of the path. For JSON values, the value is a JSON merge patch
+	// to be applied to the existing value (see ApplyMergePatch()).
+	Update(path *Path, value Value, ts *Timestamp) error
+
+	// Remove removes the value of the path.
+	Remove(path *Path, ts *Timestamp) error
+
+	// Query returns the stored path/values for the Selector s (absolute). It can return path/values
+	// not matching s, which are filtered out by the Workspace.
+	Query(s *Selector) ([]StoredData, error)
+}
+
+// timestampSize is the size of an encoded Timestamp (time and clock id).
+const timestampSize = 8 + 16
+
+// registeredStorage is a storage registered by a Workspace.
+type registeredStorage struct {
+	zsto *znet.Storage
+	sh   *storageHandler
+}
+
+// storageHandler receives the changes and queries for a StorageBackend.
+type storageHandler struct {
+	w       *Workspace
+	s       *Selector
+	backend StorageBackend
+	logger  *log.Entry
+
+	tasksMu   *sync.Mutex // serializes the tasks, if the Workspace has no executor
+	mu        *sync.Mutex
+	latest    map[Path]Timestamp
+	lastWrite map[Path]time.Time
+
+	// only with retention rules
+	retention *retention
+}
+
+// RegisterStorage registers a StorageBackend storing the path/values matching the provided Selector.
+//
+// The changes published into Zenoh for the selection are decoded and passed to the backend with their
+// Timestamp (generated if missing). The queries intersecting the selection are answered with the
+// path/values returned by the backend's Query operation which match the query's path expression.
+// As zenoh-net doesn't support Timestamps in replies, the Timestamps of the path/values are
+// transmitted within the data of the replies, but only to the zenoh-go queriers, which ask for it.
+// The other queriers receive the values unchanged.
+//
+// The backend's operations are executed by the I/O subroutine, or by the executor of the Workspace
+// if it has one. Its errors are logged.
+//
+// It returns an error if a storage is already registered with the same path via the Workspace.
+func (w *Workspace) RegisterStorage(selector *Selector, backend StorageBackend) error {
+	return w.RegisterStorageWithOptions(selector, backend, nil)
+}
+
+// RegisterStorageWithOptions registers a StorageBackend storing the path/values matching the provided
+// Selector, as RegisterStorage() does, but with the retention rules specified by opts.
+// If opts is nil, the default StorageOptions are used (i.e. no retention rules).
+func (w *Workspace) RegisterStorageWithOptions(selector *Selector, backend StorageBackend, opts *StorageOptions) error {
+	s := w.toAbsoluteSelector(selector)
+	logger := logger.WithField("selector", s)
+	logger.Debug("RegisterStorage")
+	w.mu.Lock()
+	err := w.checkStorageFree(s)
+	w.mu.Unlock()
+	if err != nil {
+		return err
+	}
+
+	sh := newStorageHandler(w, s, backend)
+	if opts != nil && len(opts.Retention) > 0 {
+		if sh.retention, err = newRetention(w, opts); err != nil {
+			return &ZError{Msg: "RegisterStorage on " + s.ToString() + " failed", Code: 0, Cause: err}
+		}
+	}
+	zsto, err := w.session.DeclareStorage(s.Path(), sh.handleData, sh.handleQuery)
+	if err != nil {
+		return &ZError{Msg: "RegisterStorage on " + s.ToString() + " failed", Code: 0, Cause: err}
+	}
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	if err := w.track(); err != nil {
+		w.session.UndeclareStorage(zsto)
+		return &ZError{Msg: "RegisterStorage on " + s.ToString() + " failed", Code: 0, Cause: err}
+	}
+	// registered meanwhile
+	if err := w.checkStorageFree(s); err != nil {
+		w.session.UndeclareStorage(zsto)
+		return err
+	}
+	w.storages[s.Path()] = &registeredStorage{zsto, sh}
+	if sh.retention != nil {
+		go sh.retention.run(sh)
+	}
+	return nil
+}
+
+// checkStorageFree returns an error if a storage is already registered on the path of s.
+// w.mu must be locked by the caller.
+func (w *Workspace) checkStorageFree(s *Selector) error {
+	if _, ok := w.storages[s.Path()]; ok {
+		return &ZError{Msg: "RegisterStorage on " + s.ToString() + " failed: a storage is already registered on " + s.Path(),
+			Code: 0, Cause: nil}
+	}
+	return nil
+}
+
+// UnregisterStorage unregisters a previously registered StorageBackend.
+//
+// The selector is the same that has been used for registration.
+func (w *Workspace) UnregisterStorage(selector *Selector) error {
+	s := w.toAbsoluteSelector(selector)
+	w.mu.Lock()
+	rs, ok := w.storages[s.Path()]
+	delete(w.storages, s.Path())
+	w.mu.Unlock()
+	if ok {
+		rs.sh.stop()
+		if err := w.session.UndeclareStorage(rs.zsto); err != nil {
+			return &ZError{Msg: "UnregisterStorage on " + s.ToString() + " failed", Code: 0, Cause: err}
+		}
+	}
+	return nil
+}
+
+// stop stops applying the retention rules, if any.
+func (sh *storageHandler) stop() {
+	if sh.retention != nil {
+		sh.retention.stop()
+	}
+}
+
+func newStorageHandler(w *Workspace, s *Selector, backend StorageBackend) *storageHandler {
+	return &storageHandler{w: w, s: s, backend: backend, logger: logger.WithField("selector", s),
+		tasksMu: new(sync.Mutex), mu: new(sync.Mutex), latest: make(map[Path]Timestamp), lastWrite: make(map[Path]time.Time)}
+}
+
+// run executes a task for key, via the executor of the Workspace if it has one.
+// The tasks for a same key are not executed concurrently.
+func (sh *storageHandler) run(key string, task func()) bool {
+	if sh.w.executor != nil {
+		return sh.w.executor.submit(key, task)
+	}
+	// the tasks can be run by the I/O subroutine, and by the subroutine applying the retention rules
+	sh.tasksMu.Lock()
+	defer sh.tasksMu.Unlock()
+	task()
+	return true
+}
+
+func (sh *storageHandler) handleData(rname string, data []byte, info *znet.DataInfo) {
+	path, err := NewPath(rname)
+	if err != nil {
+		sh.logger.WithField("path", rname).Warn("Storage received a change for an invalid path")
+		return
+	}
+	var ts Timestamp
+	if t := info.Tstamp(); t != nil {
+		ts = *t
+		sh.w.z.clock.update(t)
+	} else {
+		ts = *sh.w.z.clock.newTimestamp()
+	}
+	kind := info.Kind()
+	var value Value
+	if kind != REMOVE {
+		decoder, ok := valueDecoders[info.Encoding()]
+		if !ok {
+			sh.logger.WithFields(log.Fields{
+				"path":     rname,
+				"encoding": info.Encoding(),
+			}).Warn("Storage : no Decoder found for change")
+			return
+		}
+		if value, err = decoder(data); err != nil {
+			sh.logger.WithFields(log.Fields{
+				"path":     rname,
+				"encoding": info.Encoding(),
+				"error":    err,
+			}).Warn("Storage : error decoding change")
+			return
+		}
+	}
+
+	ok := sh.run(rname, func() {
+		if err := sh.storeChange(kind, path, value, &ts); err != nil {
+			sh.logger.WithFields(log.Fields{
+				"path":  path,
+				"kind":  kind,
+				"error": err,
+			}).Warn("Storage failed to store change")
+		}
+	})
+	if !ok {
+		sh.logger.WithField("path", path).Debug("Storage : change dropped by executor (full or shut down)")
+	}
+}
+
+// storeChange passes a change to the backend. A backend keeping the history of the paths
+// (i.e. a SampleEvicter) receives all the changes, while the other backends only receive
+// the changes more recent than the last one received for the path.
+// It must be called by a task (see run()).
+func (sh *storageHandler) storeChange(kind ChangeKind, path *Path, value Value, ts *Timestamp) error {
+	latest := sh.isLatest(path, ts)
+	if !latest {
+		if _, keepsHistory := sh.backend.(SampleEvicter); !keepsHistory {
+			sh.logger.WithField("path", path).Debug("Storage : change older than the stored one dropped")
+			return nil
+		}
+	}
+	if kind == REMOVE && latest {
+		sh.forget(path)
+	}
+	return sh.store(kind, path, value, ts)
+}
+
+// storeAndWait passes a change to the backend as storeChange() does, but via a task,
+// and waits for its completion.
+func (sh *storageHandler) storeAndWait(kind ChangeKind, path *Path, value Value, ts *Timestamp) error {
+	done := make(chan error, 1)
+	ok := sh.run(path.ToString(), func() {
+		done <- sh.storeChange(kind, path, value, ts)
+	})
+	if !ok {
+		return &ZError{Msg: "Store of " + path.ToString() + " dropped by executor (full or shut down)", Code: 0, Cause: nil}
+	}
+	return <-done
+}
+
+// store passes a change to the backend.
+func (sh *storageHandler) store(kind ChangeKind, path *Path, value Value, ts *Timestamp) error {
+	switch kind {
+	case REMOVE:
+		return sh.backend.Remove(path, ts)
+	case UPDATE:
+		return sh.backend.Update(path, value, ts)
+	default:
+		return sh.backend.Put(path, value, ts)
+	}
+}
+
+// isLatest returns true if ts is more recent than the Timestamp of the last change for path,
+// and records ts as such.
+func (sh *storageHandler) isLatest(path *Path, ts *Timestamp) bool {
+	sh.mu.Lock()
+	defer sh.mu.Unlock()
+	if last, ok := sh.latest[*path]; ok && !last.Before(ts) {
+		return false
+	}
+	sh.latest[*path] = *ts
+	sh.lastWrite[*path] = time.Now()
+	return true
+}
+
+// forget drops the last write time of a removed path. Only its latest Timestamp is kept,
+// to drop the older changes.
+func (sh *storageHandler) forget(path *Path) {
+	sh.mu.Lock()
+	delete(sh.lastWrite, *path)
+	sh.mu.Unlock()
+}
+
+func (sh *storageHandler) handleQuery(rname string, predicate string, repliesSender *znet.RepliesSender) {
+	sh.logger.WithFields(log.Fields{
+		"rname":     rname,
+		"predicate": predicate,
+	}).Debug("Storage handling query")
+	s, err := NewSelector(rname + "?" + predicate)
+	if err != nil {
+		sh.logger.WithField("rname", rname).Warn("Storage received query for an invalid selector")
+		repliesSender.SendReplies(nil)
+		return
+	}
+
+	s, extReplies := withoutExtReplies(s)
+	ok := sh.run(rname, func() {
+		replied := false
+		// the task can be executed by the executor, where zenoh-net cannot recover a panic
+		defer func() {
+			if r := recover(); r != nil {
+				queryPanic(sh.logger, rname, r)
+				if !replied {
+					repliesSender.SendReplies(nil)
+				}
+			}
+		}()
+		stored, err := sh.backend.Query(s)
+		if err != nil {
+			sh.logger.WithFields(log.Fields{
+				"selector": s,
+				"error":    err,
+			}).Warn("Storage failed to handle query")
+			replied = true
+			repliesSender.SendReplies(nil)
+			return
+		}
+		replies := make([]znet.Resource, 0, len(stored))
+		for _, sd := range stored {
+			if sd.Value == nil || !znet.RNameIntersect(rname, sd.Path.ToString()) {
+				continue
+			}
+			r := znet.Resource{
+				RName:    sd.Path.ToString(),
+				Data:     sd.Value.Encode(),
+				Encoding: sd.Value.Encoding(),
+				Kind:     PUT,
+			}
+			if extReplies {
+				if sd.Timestamp != nil {
+					r.Data = extReplyData(extReplyTimestamped, encodeTimestamp(sd.Timestamp), r.Data)
+				} else {
+					r.Data = plainReplyData(r.Data)
+				}
+			}
+			replies = append(replies, r)
+		}
+		replied = true
+		repliesSender.SendReplies(replies)
+	})
+	if !ok {
+		sh.logger.WithField("rname", rname).Debug("Storage : query dropped by executor (full or shut down)")
+		repliesSender.SendReplies(nil)
+	}
+}
+
+// encodeTimestamp returns the Timestamp prefixing the value of an extReplyTimestamped reply.
+func encodeTimestamp(ts *Timestamp) []byte {
+	buf := make([]byte, timestampSize)
+	binary.BigEndian.PutUint64(buf, ts.Time())
+	clk := ts.ClockID()
+	copy(buf[8:], clk[:])
+	return buf
+}
+
+// decodeTimestamped returns the Timestamp prefixing the payload of an extReplyTimestamped reply,
+// and the remaining data. It returns false if the payload is too short.
+func decodeTimestamped(payload []byte) (*Timestamp, []byte, bool) {
+	if len(payload) < timestampSize {
+		return nil, payload, false
+	}
+	var clk [16]byte
+	copy(clk[:], payload[8:timestampSize])
+	return zcore.NewTimestamp(binary.BigEndian.Uint64(payload), clk), payload[timestampSize:], true
+}
@@ -0,0 +1,105 @@
+/*
+ * Copyright (c) 2017, 2020 ADLINK Technology Inc.
+ *
+ * This program and the accompanying materials are made available under the
+ * terms of the Eclipse Public License 2.0 which is available at
+ * http://www.eclipse.org/legal/epl-2.0, or the Apache License, Version 2.0
+ * which is available at https://www.apache.org/licenses/LICENSE-2.0.
+ *
+ * SPDX-License-Identifier: EPL-2.0 OR Apache-2.0
+ *
+ * Contributors:
+ *   ADLINK zenoh team, <zenoh@adlink-labs.tech>
+ */
+
+package zenoh
+
+import (
+	"bytes"
+	"sync"
+	"testing"
+)
+
+func TestTimestampedData(t *testing.T) {
+	ts := testTimestamp(42)
+	data := extReplyData(extReplyTimestamped, encodeTimestamp(ts), []byte("value"))
+	tag, payload, ok := decodeExtReply(data)
+	if !ok || tag != extReplyTimestamped {
+		t.Fatalf("decodeExtReply() = %c, %q, %v", tag, payload, ok)
+	}
+	decoded, value, ok := decodeTimestamped(payload)
+	if !ok || decoded.Time() != 42 || decoded.ClockID() != ts.ClockID() || string(value) != "value" {
+		t.Errorf("decodeTimestamped() = %v, %q, %v", decoded, value, ok)
+	}
+	if _, _, ok := decodeTimestamped(payload[:timestampSize-1]); ok {
+		t.Error("decodeTimestamped() of truncated data succeeded")
+	}
+
+	// data of another storage, not prefixed with extReplyMagic
+	other := bytes.Repeat([]byte("x"), timestampSize+1)
+	if _, payload, ok := decodeExtReply(other); ok || !bytes.Equal(payload, other) {
+		t.Errorf("decodeExtReply() of unprefixed data = %q, %v", payload, ok)
+	}
+	// a value starting with extReplyMagic is escaped
+	magic := append(append([]byte{}, extReplyMagic...), "t12345678"...)
+	if tag, payload, ok := decodeExtReply(plainReplyData(magic)); !ok || tag != extReplyValue || !bytes.Equal(payload, magic) {
+		t.Errorf("decodeExtReply() of an escaped value = %c, %q, %v", tag, payload, ok)
+	}
+}
+
+func TestExtRepliesProperty(t *testing.T) {
+	s, _ := NewSelector("/a/**?x>1(starttime=now()-1h)#[y]")
+	ext := withExtReplies(s)
+	if withExtReplies(ext) != ext {
+		t.Error("withExtReplies() added the property twice")
+	}
+	back, ok := withoutExtReplies(ext)
+	if !ok || back.ToString() != s.ToString() {
+		t.Errorf("withoutExtReplies(%s) = %s, %v, expected %s", ext.ToString(), back.ToString(), ok, s.ToString())
+	}
+	if _, ok := withoutExtReplies(s); ok {
+		t.Errorf("%s has the propExtReplies property", s.ToString())
+	}
+}
+
+func TestDuplicateRegistration(t *testing.T) {
+	root, _ := NewPath("/test")
+	w := &Workspace{path: root, mu: new(sync.Mutex),
+		evals:    map[string]*registeredEval{"/test/a": {}, "/test/{id}/avg": {}},
+		storages: map[string]*registeredStorage{"/test/**": {}}}
+
+	s, _ := NewSelector("/test/**?x>1")
+	if err := w.RegisterStorage(s, nil); err == nil {
+		t.Errorf("RegisterStorage(%s) succeeded with a storage registered on /test/**", s.ToString())
+	}
+	p, _ := NewPath("a")
+	if err := w.RegisterDataEval(p, nil); err == nil {
+		t.Errorf("RegisterDataEval(%s) succeeded with an eval registered on /test/a", p.ToString())
+	}
+	pe, _ := NewPathExpr("/test/{id}/avg")
+	if err := w.RegisterEvalHandler(pe, nil, nil); err == nil {
+		t.Errorf("RegisterEvalHandler(%s) succeeded with an eval registered on it", pe.ToString())
+	}
+}
+
+func TestStoreOutOfOrder(t *testing.T) {
+	a, _ := NewPath("/test/a")
+	history := NewHistoryBackend(nil)
+	// a backend keeping only the latest sample (not a SampleEvicter)
+	latestOnly := NewHistoryBackend(nil)
+	for _, backend := range []StorageBackend{history, struct{ StorageBackend }{latestOnly}} {
+		sh := newTestStorage(t)
+		sh.backend = backend
+		sh.storeChange(PUT, a, NewIntValue(2), testTimestamp(2))
+		sh.storeChange(PUT, a, NewIntValue(1), testTimestamp(1))
+		if values := queryPaths(t, backend, "/test/**"); values["/test/a"] != "2" {
+			t.Errorf("latest value %v, expected 2", values)
+		}
+	}
+	if n := len(history.series[*a].samples); n != 2 {
+		t.Errorf("%d samples stored by the history backend, expected 2", n)
+	}
+	if n := len(latestOnly.series[*a].samples); n != 1 {
+		t.Errorf("%d samples stored by the latest-only backend, expected 1", n)
+	}
+}
@@ -0,0 +1,439 @@
+/*
+ * Copyright (c) 2017, 2020 ADLINK Technology Inc.
+ *
+ * This program and the accompanying materials are made available under the
+ * terms of the Eclipse Public License 2.0 which is available at
+ * http://www.eclipse.org/legal/epl-2.0, or the Apache License, Version 2.0
+ * which is available at https://www.apache.org/licenses/LICENSE-2.0.
+ *
+ * SPDX-License-Identifier: EPL-2.0 OR Apache-2.0
+ *
+ * Contributors:
+ *   ADLINK zenoh team, <zenoh@adlink-labs.tech>
+ */
+
+package zenoh
+
+import (
+	"sort"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	znet "github.com/eclipse-zenoh/zenoh-go/net"
+)
+
+// SubscriptionMode is the mode of a subscription
+type SubscriptionMode uint8
+
+const (
+	// PushMode : the changes are notified as soon as they're received.
+	PushMode SubscriptionMode = iota
+	// PullMode : the changes are notified only when pulled.
+	PullMode
+	// PeriodicPushMode : the changes are notified periodically.
+	PeriodicPushMode
+	// PeriodicPullMode : the changes are notified only when pulled, and
+	// are made available for pulling periodically.
+	PeriodicPullMode
+)
+
+// SubscribeOptions configures a subscription (see Workspace.SubscribeWithOptions()).
+type SubscribeOptions struct {
+	// Mode is the subscription mode.
+	Mode SubscriptionMode
+
+	// Origin, Period and Duration are the temporal properties of the
+	// PeriodicPushMode and PeriodicPullMode subscription modes.
+	Origin   time.Duration
+	Period   time.Duration
+	Duration time.Duration
+
+	// InitialState makes the subscription start with the notification of the current
+	// values of the selection (as returned by Workspace.Get()), merged with the changes
+	// received meanwhile. The changes are notified in Timestamp order, and the changes that
+	// are not more recent than the last notified change for the same Path are dropped.
+	//
+	// The current values are notified as PUT changes, after the subscription is returned.
+	// If the Workspace has no executor, they're notified by a dedicated subroutine.
+	InitialState bool
+
+	// initDone, if set, is closed once the initial state has been notified.
+	initDone chan struct{}
+
+	// onClose, if set, is called when the subscription is unregistered (e.g. by Workspace.Close()).
+	onClose func()
+
+	// removeFiltered makes the PUT changes with a value not satisfying the predicate
+	// notified as REMOVE changes, and the UPDATE changes notified without applying the predicate.
+	removeFiltered bool
+}
+
+func (opts *SubscribeOptions) subMode() znet.SubMode {
+	switch opts.Mode {
+	case PullMode:
+		return znet.NewSubMode(znet.ZNPullMode)
+	case PeriodicPushMode:
+		return znet.NewSubModeWithDurations(znet.ZNPeriodicPushMode, opts.Origin, opts.Period, opts.Duration)
+	case PeriodicPullMode:
+		return znet.NewSubModeWithDurations(znet.ZNPeriodicPullMode, opts.Origin, opts.Period, opts.Duration)
+	default:
+		return znet.NewSubMode(znet.ZNPushMode)
+	}
+}
+
+// OverflowPolicy defines what a ChanSubscription does with a Change
+// received while its buffer is full.
+type OverflowPolicy uint8
+
+const (
+	// OverflowBlock : wait for some room in the buffer.
+	// Notice that this blocks the I/O subroutine, and thus all the other subscriptions.
+	OverflowBlock OverflowPolicy = iota
+	// OverflowDropOldest : drop the oldest Change of the buffer.
+	OverflowDropOldest
+	// OverflowDropNewest : drop the received Change.
+	OverflowDropNewest
+	// OverflowKeepLatest : keep only the latest Change for each Path. A received Change
+	// replaces the buffered Change for the same Path, keeping its place in the buffer.
+	// If there is no buffered Change for the same Path, the oldest Change of the buffer is dropped.
+	OverflowKeepLatest
+)
+
+// ChanOptions configures a Workspace.SubscribeChan() call.
+type ChanOptions struct {
+	// SubscribeOptions configures the subscription mode.
+	SubscribeOptions
+
+	// BufferSize is the number of Changes that can be buffered, waiting to be received.
+	BufferSize int
+
+	// Overflow is the policy applied when a Change is received while the buffer is full.
+	Overflow OverflowPolicy
+}
+
+// ChanSubscription is a subscription providing the Changes via a channel (see Workspace.SubscribeChan()).
+type ChanSubscription struct {
+	dropped uint64 // accessed atomically, must stay 64-bit aligned
+
+	w      *Workspace
+	subid  *SubscriptionID
+	policy OverflowPolicy
+	c      chan Change
+
+	mu       *sync.Mutex
+	closed   bool
+	done     chan struct{}
+	stopOnce *sync.Once
+
+	// only for OverflowKeepLatest policy
+	queue    *latestQueue
+	pumpDone chan struct{}
+}
+
+// SubscribeChan subscribes to a selection of path/value from Zenoh,
+// as Subscribe() does, but provides the Changes via a channel.
+// If opts is nil, the default ChanOptions are used (i.e. no buffer and OverflowBlock policy).
+//
+// The ChanSubscription must be closed to unsubscribe.
+func (w *Workspace) SubscribeChan(selector *Selector, opts *ChanOptions) (*ChanSubscription, error) {
+	if opts == nil {
+		opts = new(ChanOptions)
+	}
+	cs := newChanSubscription(w, opts)
+
+	// the listener is called by the I/O subroutine to preserve the Changes order
+	subOpts := opts.SubscribeOptions
+	subOpts.onClose = cs.stop
+	subid, err := w.subscribe(selector, w.interceptListener(w.toAbsoluteSelector(selector), cs.listener), &subOpts, nil)
+	if err != nil {
+		cs.stop()
+		return nil, err
+	}
+	cs.subid = subid
+	return cs, nil
+}
+
+func newChanSubscription(w *Workspace, opts *ChanOptions) *ChanSubscription {
+	cs := &ChanSubscription{
+		w:        w,
+		policy:   opts.Overflow,
+		mu:       new(sync.Mutex),
+		done:     make(chan struct{}),
+		stopOnce: new(sync.Once),
+	}
+	if opts.Overflow == OverflowKeepLatest {
+		cs.c = make(chan Change)
+		cs.queue = newLatestQueue(opts.BufferSize)
+		cs.pumpDone = make(chan struct{})
+		go cs.pump()
+	} else {
+		cs.c = make(chan Change, opts.BufferSize)
+	}
+	return cs
+}
+
+// listener pushes the Changes to the channel.
+func (cs *ChanSubscription) listener(changes []Change) {
+	for _, change := range changes {
+		cs.push(change)
+	}
+}
+
+// C returns the channel providing the Changes.
+// The channel is closed when the ChanSubscription is closed, or when the Workspace is closed.
+func (cs *ChanSubscription) C() <-chan Change {
+	return cs.c
+}
+
+// Dropped returns the number of Changes dropped because of the overflow policy.
+func (cs *ChanSubscription) Dropped() uint64 {
+	return atomic.LoadUint64(&cs.dropped)
+}
+
+// ID returns the SubscriptionID of the ChanSubscription.
+func (cs *ChanSubscription) ID() *SubscriptionID {
+	return cs.subid
+}
+
+// Pull pulls the changes for a subscription in PullMode or PeriodicPullMode.
+func (cs *ChanSubscription) Pull() error {
+	if err := cs.subid.Pull(); err != nil {
+		return &ZError{Msg: "Pull failed", Code: 0, Cause: err}
+	}
+	return nil
+}
+
+// Close unsubscribes and closes the channel.
+// It does nothing if the ChanSubscription has already been closed (e.g. by Workspace.Close()).
+func (cs *ChanSubscription) Close() error {
+	cs.mu.Lock()
+	closed := cs.closed
+	cs.mu.Unlock()
+	if closed {
+		return nil
+	}
+	err := cs.w.Unsubscribe(cs.subid)
+	cs.stop()
+	return err
+}
+
+// stop stops pushing Changes and closes the channel.
+func (cs *ChanSubscription) stop() {
+	cs.stopOnce.Do(func() {
+		close(cs.done)
+		// wait for a push in progress
+		cs.mu.Lock()
+		cs.closed = true
+		cs.mu.Unlock()
+		if cs.pumpDone != nil {
+			<-cs.pumpDone
+		}
+		close(cs.c)
+	})
+}
+
+func (cs *ChanSubscription) push(change Change) {
+	cs.mu.Lock()
+	defer cs.mu.Unlock()
+	if cs.closed {
+		return
+	}
+	switch cs.policy {
+	case OverflowDropNewest:
+		select {
+		case cs.c <- change:
+		default:
+			atomic.AddUint64(&cs.dropped, 1)
+		}
+	case OverflowDropOldest:
+		for {
+			select {
+			case cs.c <- change:
+				return
+			default:
+				select {
+				case <-cs.c:
+					atomic.AddUint64(&cs.dropped, 1)
+				default:
+					// no buffered Change to drop (e.g. no buffer)
+					atomic.AddUint64(&cs.dropped, 1)
+					return
+				}
+			}
+		}
+	case OverflowKeepLatest:
+		if cs.queue.push(change) {
+			atomic.AddUint64(&cs.dropped, 1)
+		}
+	default:
+		select {
+		case cs.c <- change:
+		case <-cs.done:
+		}
+	}
+}
+
+// pump sends the Changes from the latestQueue to the channel.
+func (cs *ChanSubscription) pump() {
+	defer close(cs.pumpDone)
+	for {
+		select {
+		case <-cs.queue.signal:
+		case <-cs.done:
+			return
+		}
+		for change, ok := cs.queue.pop(); ok; change, ok = cs.queue.pop() {
+			select {
+			case cs.c <- change:
+			case <-cs.done:
+				return
+			}
+		}
+	}
+}
+
+// latestQueue is a bounded FIFO of Changes, keeping only the latest Change for each Path.
+type latestQueue struct {
+	mu      *sync.Mutex
+	size    int
+	order   []Path
+	pending map[Path]Change
+	signal  chan struct{}
+}
+
+func newLatestQueue(size int) *latestQueue {
+	if size < 1 {
+		size = 1
+	}
+	return &latestQueue{new(sync.Mutex), size, make([]Path, 0, size), make(map[Path]Change), make(chan struct{}, 1)}
+}
+
+// push adds a Change to the queue, and returns true if a Change has been dropped.
+func (q *latestQueue) push(change Change) bool {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	dropped := false
+	if _, ok := q.pending[*change.path]; ok {
+		dropped = true
+	} else {
+		if len(q.order) >= q.size {
+			delete(q.pending, q.order[0])
+			q.order = q.order[1:]
+			dropped = true
+		}
+		q.order = append(q.order, *change.path)
+	}
+	q.pending[*change.path] = change
+	select {
+	case q.signal <- struct{}{}:
+	default:
+	}
+	return dropped
+}
+
+// pop removes and returns the oldest Change of the queue, if any.
+func (q *latestQueue) pop() (Change, bool) {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	if len(q.order) == 0 {
+		return Change{}, false
+	}
+	p := q.order[0]
+	q.order = q.order[1:]
+	change := q.pending[p]
+	delete(q.pending, p)
+	return change, true
+}
+
+// initialStateMerger merges the initial state of a selection, got by a query, with the
+// changes received meanwhile, and drops the duplicate and older changes.
+//
+// The initial state is dispatched by a dedicated subroutine, and the changes received
+// until it's fully dispatched are queued after it, so that neither the subroutine
+// getting the initial state nor the I/O subroutine wait for the listener.
+type initialStateMerger struct {
+	mu       *sync.Mutex
+	fetching bool
+	draining bool
+	pending  []Change
+	latest   map[Path]*Timestamp
+	dispatch func([]Change)
+	// if set, closed once the initial state has been dispatched
+	initDone chan struct{}
+}
+
+func newInitialStateMerger(dispatch func([]Change), initDone chan struct{}) *initialStateMerger {
+	return &initialStateMerger{new(sync.Mutex), true, false, make([]Change, 0), make(map[Path]*Timestamp),
+		dispatch, initDone}
+}
+
+// notify dispatches a received change, or queues it until the initial state is dispatched.
+func (m *initialStateMerger) notify(change Change) {
+	m.mu.Lock()
+	if m.fetching || m.draining {
+		m.pending = append(m.pending, change)
+		m.mu.Unlock()
+		return
+	}
+	ok := m.isLatest(change)
+	m.mu.Unlock()
+	if ok {
+		m.dispatch([]Change{change})
+	}
+}
+
+// init merges the initial state with the changes received meanwhile,
+// and starts dispatching them in a new subroutine.
+func (m *initialStateMerger) init(data []Data) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	changes := m.pending
+	for _, d := range data {
+		changes = append(changes, Change{d.path, PUT, d.tstamp, d.value, d.err})
+	}
+	// sort per Timestamp, the changes without Timestamp coming last
+	sort.SliceStable(changes, func(i, j int) bool {
+		ti, tj := changes[i].timestamp, changes[j].timestamp
+		return ti != nil && (tj == nil || ti.Before(tj))
+	})
+	m.pending = changes
+	m.fetching = false
+	m.draining = true
+	go m.drain()
+}
+
+// drain dispatches the queued changes, until there is no more.
+func (m *initialStateMerger) drain() {
+	if m.initDone != nil {
+		defer close(m.initDone)
+	}
+	for {
+		m.mu.Lock()
+		if len(m.pending) == 0 {
+			m.pending = nil
+			m.draining = false
+			m.mu.Unlock()
+			return
+		}
+		change := m.pending[0]
+		m.pending = m.pending[1:]
+		ok := m.isLatest(change)
+		m.mu.Unlock()
+		if ok {
+			m.dispatch([]Change{change})
+		}
+	}
+}
+
+// isLatest returns true if the change is more recent than the last one dispatched for the same Path,
+// and records it as such. m.mu must be locked by the caller.
+func (m *initialStateMerger) isLatest(change Change) bool {
+	if change.timestamp != nil {
+		if ts, ok := m.latest[*change.path]; ok && !ts.Before(change.timestamp) {
+			return false
+		}
+		m.latest[*change.path] = change.timestamp
+	}
+	return true
+}
@@ -0,0 +1,246 @@
+/*
+ * Copyright (c) 2017, 2020 ADLINK Technology Inc.
+ *
+ * This program and the accompanying materials are made available under the
+ * terms of the Eclipse Public License 2.0 which is available at
+ * http://www.eclipse.org/legal/epl-2.0, or the Apache License, Version 2.0
+ * which is available at https://www.apache.org/licenses/LICENSE-2.0.
+ *
+ * SPDX-License-Identifier: EPL-2.0 OR Apache-2.0
+ *
+ * Contributors:
+ *   ADLINK zenoh team, <zenoh@adlink-labs.tech>
+ */
+
+package zenoh
+
+import (
+	"strconv"
+	"testing"
+	"time"
+
+	zcore "github.com/eclipse-zenoh/zenoh-go/core"
+	znet "github.com/eclipse-zenoh/zenoh-go/net"
+)
+
+func testTimestamp(t uint64) *Timestamp {
+	return zcore.NewTimestamp(t, [16]byte{1})
+}
+
+func TestInitialStateLargerThanBuffer(t *testing.T) {
+	const n = 10
+	cs := newChanSubscription(nil, &ChanOptions{BufferSize: 2})
+	initDone := make(chan struct{})
+	m := newInitialStateMerger(cs.listener, initDone)
+
+	data := make([]Data, n)
+	for i := range data {
+		p, _ := NewPath("/test/" + strconv.Itoa(i))
+		data[i] = Data{path: p, value: NewIntValue(int64(i)), tstamp: testTimestamp(uint64(i + 1))}
+	}
+	// a change received while fetching, older than the initial state of its path
+	m.notify(Change{data[0].path, PUT, testTimestamp(0), NewIntValue(-1), nil})
+
+	initialized := make(chan struct{})
+	go func() {
+		m.init(data)
+		close(initialized)
+	}()
+	select {
+	case <-initialized:
+	case <-time.After(5 * time.Second):
+		t.Fatal("init blocked by the full channel")
+	}
+	// a change received while the initial state is dispatched
+	p, _ := NewPath("/test/0")
+	m.notify(Change{p, PUT, testTimestamp(n + 1), NewIntValue(n), nil})
+
+	for i := -1; i <= n; i++ {
+		select {
+		case change := <-cs.C():
+			if change.Value().ToString() != strconv.Itoa(i) {
+				t.Errorf("received %s, expected %d", change.Value().ToString(), i)
+			}
+		case <-time.After(5 * time.Second):
+			t.Fatalf("change %d not received", i)
+		}
+	}
+	<-initDone
+	cs.stop()
+}
+
+func TestInitialStateDropsOlderChanges(t *testing.T) {
+	received := make([]Change, 0)
+	m := newInitialStateMerger(func(changes []Change) { received = append(received, changes...) }, nil)
+	p, _ := NewPath("/test/a")
+	m.notify(Change{p, PUT, testTimestamp(3), NewIntValue(3), nil})
+	m.notify(Change{p, PUT, testTimestamp(1), NewIntValue(1), nil})
+	initDone := make(chan struct{})
+	m.initDone = initDone
+	m.init([]Data{{path: p, value: NewIntValue(2), tstamp: testTimestamp(2)}})
+	<-initDone
+	m.notify(Change{p, PUT, testTimestamp(3), NewIntValue(3), nil})
+	m.notify(Change{p, PUT, testTimestamp(4), NewIntValue(4), nil})
+
+	expected := []string{"1", "2", "3", "4"}
+	if len(received) != len(expected) {
+		t.Fatalf("received %d changes, expected %d", len(received), len(expected))
+	}
+	for i := range expected {
+		if received[i].Value().ToString() != expected[i] {
+			t.Errorf("change %d is %s, expected %s", i, received[i].Value().ToString(), expected[i])
+		}
+	}
+}
+
+func testChange(path string, v int64) Change {
+	p, _ := NewPath(path)
+	return Change{p, PUT, testTimestamp(uint64(v)), NewIntValue(v), nil}
+}
+
+// received returns the Changes buffered in a stopped ChanSubscription.
+func received(cs *ChanSubscription) []string {
+	values := make([]string, 0)
+	for change := range cs.C() {
+		values = append(values, change.Path().ToString()+"="+change.Value().ToString())
+	}
+	return values
+}
+
+func TestOverflowDrop(t *testing.T) {
+	tests := []struct {
+		policy   OverflowPolicy
+		expected []string
+	}{
+		{OverflowDropNewest, []string{"/test/1=1", "/test/2=2"}},
+		{OverflowDropOldest, []string{"/test/3=3", "/test/4=4"}},
+	}
+	for _, test := range tests {
+		cs := newChanSubscription(nil, &ChanOptions{BufferSize: 2, Overflow: test.policy})
+		for i := int64(1); i <= 4; i++ {
+			cs.push(testChange("/test/"+strconv.FormatInt(i, 10), i))
+		}
+		if cs.Dropped() != 2 {
+			t.Errorf("policy %d dropped %d changes, expected 2", test.policy, cs.Dropped())
+		}
+		cs.stop()
+		values := received(cs)
+		if len(values) != len(test.expected) {
+			t.Errorf("policy %d buffered %v, expected %v", test.policy, values, test.expected)
+			continue
+		}
+		for i := range values {
+			if values[i] != test.expected[i] {
+				t.Errorf("policy %d buffered %v, expected %v", test.policy, values, test.expected)
+				break
+			}
+		}
+	}
+}
+
+func TestOverflowBlock(t *testing.T) {
+	cs := newChanSubscription(nil, &ChanOptions{BufferSize: 1, Overflow: OverflowBlock})
+	cs.push(testChange("/test/a", 1))
+	pushed := make(chan struct{})
+	go func() {
+		cs.push(testChange("/test/a", 2))
+		close(pushed)
+	}()
+	select {
+	case <-pushed:
+		t.Fatal("push didn't block on the full buffer")
+	case <-time.After(50 * time.Millisecond):
+	}
+	if change := <-cs.C(); change.Value().ToString() != "1" {
+		t.Errorf("received %s, expected 1", change.Value().ToString())
+	}
+	select {
+	case <-pushed:
+	case <-time.After(5 * time.Second):
+		t.Fatal("push still blocked after a receive")
+	}
+
+	// stop releases a blocked push
+	pushed = make(chan struct{})
+	go func() {
+		cs.push(testChange("/test/a", 3))
+		close(pushed)
+	}()
+	time.Sleep(10 * time.Millisecond)
+	cs.stop()
+	select {
+	case <-pushed:
+	case <-time.After(5 * time.Second):
+		t.Fatal("push still blocked after stop")
+	}
+	if cs.Dropped() != 0 {
+		t.Errorf("OverflowBlock dropped %d changes", cs.Dropped())
+	}
+}
+
+func TestOverflowKeepLatest(t *testing.T) {
+	q := newLatestQueue(2)
+	if q.push(testChange("/test/a", 1)) || q.push(testChange("/test/b", 2)) {
+		t.Error("a change was dropped while the queue isn't full")
+	}
+	// replaces /test/a=1, keeping its place
+	if !q.push(testChange("/test/a", 3)) {
+		t.Error("the replaced change wasn't counted as dropped")
+	}
+	// drops the oldest change: /test/a=3
+	if !q.push(testChange("/test/c", 4)) {
+		t.Error("the oldest change wasn't counted as dropped")
+	}
+	expected := []string{"/test/b=2", "/test/c=4"}
+	for _, e := range expected {
+		change, ok := q.pop()
+		if !ok || change.Path().ToString()+"="+change.Value().ToString() != e {
+			t.Errorf("pop() = %v, %v, expected %s", change.Value(), ok, e)
+		}
+	}
+	if _, ok := q.pop(); ok {
+		t.Error("pop() of an empty queue succeeded")
+	}
+
+	// whatever the pump already sent, the latest value of each path is received
+	const n = 100
+	cs := newChanSubscription(nil, &ChanOptions{BufferSize: 2, Overflow: OverflowKeepLatest})
+	for i := int64(1); i <= n; i++ {
+		cs.push(testChange("/test/"+strconv.FormatInt(i%2, 10), i))
+	}
+	latest := make(map[string]string)
+	count := uint64(0)
+	for len(latest) < 2 || latest["/test/0"] != strconv.Itoa(n) || latest["/test/1"] != strconv.Itoa(n-1) {
+		select {
+		case change := <-cs.C():
+			latest[change.Path().ToString()] = change.Value().ToString()
+			count++
+		case <-time.After(5 * time.Second):
+			t.Fatalf("latest changes not received: %v", latest)
+		}
+	}
+	cs.stop()
+	if count+cs.Dropped() != n {
+		t.Errorf("received %d and dropped %d changes, expected %d in total", count, cs.Dropped(), n)
+	}
+}
+
+func TestSubMode(t *testing.T) {
+	period := 100 * time.Millisecond
+	tests := []struct {
+		opts     SubscribeOptions
+		expected znet.SubMode
+	}{
+		{SubscribeOptions{}, znet.NewSubMode(znet.ZNPushMode)},
+		{SubscribeOptions{Mode: PullMode}, znet.NewSubMode(znet.ZNPullMode)},
+		{SubscribeOptions{Mode: PeriodicPushMode, Period: period},
+			znet.NewSubModeWithDurations(znet.ZNPeriodicPushMode, 0, period, 0)},
+		{SubscribeOptions{Mode: PeriodicPullMode, Origin: time.Second, Period: period, Duration: period},
+			znet.NewSubModeWithDurations(znet.ZNPeriodicPullMode, time.Second, period, period)},
+	}
+	for _, test := range tests {
+		if mode := test.opts.subMode(); mode != test.expected {
+			t.Errorf("subMode() of mode %d = %v, expected %v", test.opts.Mode, mode, test.expected)
+		}
+	}
+}
@@ -0,0 +1,207 @@
+/*
+ * Copyright (c) 2017, 2020 ADLINK Technology Inc.
+ *
+ * This program and the accompanying materials are made available under the
+ * terms of the Eclipse Public License 2.0 which is available at
+ * http://www.eclipse.org/legal/epl-2.0, or the Apache License, Version 2.0
+ * which is available at https://www.apache.org/licenses/LICENSE-2.0.
+ *
+ * SPDX-License-Identifier: EPL-2.0 OR Apache-2.0
+ *
+ * Contributors:
+ *   ADLINK zenoh team, <zenoh@adlink-labs.tech>
+ */
+
+package zenoh
+
+import (
+	"regexp"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Selector properties used by the storages to select a time range
+const (
+	propStartTime = "starttime"
+	propStopTime  = "stoptime"
+)
+
+// TimeExpr is a time expression, used as a bound of a time range (see Workspace.GetRangeExpr()).
+// It's either an absolute time, or a time relative to the time at which the storage
+// processes the query (e.g. "now()-1h").
+//
+// The zero TimeExpr is an unset bound.
+type TimeExpr struct {
+	expr string
+}
+
+const timeExprLayout = "2006-01-02T15:04:05.999999999Z07:00"
+
+// timeExprUnits are the units accepted by zenoh in relative time expressions, from the largest one.
+var timeExprUnits = []struct {
+	unit string
+	d    time.Duration
+}{
+	{"d", 24 * time.Hour},
+	{"h", time.Hour},
+	{"m", time.Minute},
+	{"s", time.Second},
+	{"ms", time.Millisecond},
+}
+
+var relativeTimeExprRegexp = regexp.MustCompile(`^now\(\)(([+-])([0-9]+)(d|h|m|s|ms))?$`)
+
+// AtTime returns a TimeExpr for the absolute time t.
+func AtTime(t time.Time) TimeExpr {
+	return TimeExpr{t.UTC().Format(timeExprLayout)}
+}
+
+// Now returns a TimeExpr for the time at which the storage processes the query (i.e. "now()").
+func Now() TimeExpr {
+	return TimeExpr{"now()"}
+}
+
+// Ago returns a TimeExpr for the duration d before the time at which the storage
+// processes the query (e.g. "now()-1h").
+func Ago(d time.Duration) TimeExpr {
+	return FromNow(-d)
+}
+
+// FromNow returns a TimeExpr for the time at which the storage processes the query,
+// shifted by the duration d (e.g. "now()+30s" or "now()-1h").
+// As relative time expressions don't support units smaller than the millisecond,
+// d is rounded to the millisecond.
+func FromNow(d time.Duration) TimeExpr {
+	d = d.Round(time.Millisecond)
+	if d == 0 {
+		return Now()
+	}
+	sign := "+"
+	if d < 0 {
+		sign = "-"
+		d = -d
+	}
+	for _, u := range timeExprUnits {
+		if d%u.d == 0 {
+			return TimeExpr{"now()" + sign + strconv.FormatInt(int64(d/u.d), 10) + u.unit}
+		}
+	}
+	// unreachable: d is a multiple of a millisecond
+	return Now()
+}
+
+// ParseTimeExpr returns a new TimeExpr from the string s, if it's either a RFC3339 time,
+// either a relative time expression such as "now()", "now()-1h" or "now()+30s".
+// Supported units in relative time expressions are: "d", "h", "m", "s" and "ms".
+// Otherwise, it returns an error.
+func ParseTimeExpr(s string) (TimeExpr, error) {
+	if relativeTimeExprRegexp.MatchString(s) {
+		return TimeExpr{s}, nil
+	}
+	t, err := time.Parse(time.RFC3339Nano, s)
+	if err != nil {
+		return TimeExpr{}, &ZError{Msg: "Invalid time expression: " + s, Code: 0, Cause: err}
+	}
+	return AtTime(t), nil
+}
+
+// IsSet returns false for the zero TimeExpr (i.e. an unset bound).
+func (t TimeExpr) IsSet() bool {
+	return len(t.expr) > 0
+}
+
+// ToString returns the TimeExpr as a string
+func (t TimeExpr) ToString() string {
+	return t.expr
+}
+
+// Time returns the time of the TimeExpr, a relative time expression being relative to now.
+// It returns an error for the zero TimeExpr.
+func (t TimeExpr) Time(now time.Time) (time.Time, error) {
+	m := relativeTimeExprRegexp.FindStringSubmatch(t.expr)
+	if m == nil {
+		result, err := time.Parse(time.RFC3339Nano, t.expr)
+		if err != nil {
+			return time.Time{}, &ZError{Msg: "Invalid time expression: " + t.expr, Code: 0, Cause: err}
+		}
+		return result, nil
+	}
+	if len(m[1]) == 0 {
+		return now, nil
+	}
+	n, err := strconv.ParseInt(m[3], 10, 64)
+	if err != nil {
+		return time.Time{}, &ZError{Msg: "Invalid time expression: " + t.expr, Code: 0, Cause: err}
+	}
+	var d time.Duration
+	for _, u := range timeExprUnits {
+		if u.unit == m[4] {
+			d = time.Duration(n) * u.d
+		}
+	}
+	if m[2] == "-" {
+		d = -d
+	}
+	return now.Add(d), nil
+}
+
+// timeRangeOf returns the bounds of the time range specified by the "starttime" and "stoptime"
+// properties of the Selector s, if any. The unset bounds are zero time.Time.
+func timeRangeOf(s *Selector, now time.Time) (from time.Time, to time.Time, isRange bool, err error) {
+	props := propertiesOfString(s.Properties())
+	if start, ok := props[propStartTime]; ok {
+		if from, err = (TimeExpr{start}).Time(now); err != nil {
+			return
+		}
+		isRange = true
+	}
+	if stop, ok := props[propStopTime]; ok {
+		if to, err = (TimeExpr{stop}).Time(now); err != nil {
+			return
+		}
+		isRange = true
+	}
+	return
+}
+
+// withTimeRange returns a copy of the Selector s with its "starttime" and "stoptime" properties
+// replaced with the specified bounds. Unset bounds are omitted.
+func withTimeRange(s *Selector, from TimeExpr, to TimeExpr) *Selector {
+	props := ""
+	for _, kv := range propertiesOfList(s.properties) {
+		if kv[0] != propStartTime && kv[0] != propStopTime {
+			props = appendProperty(props, kv[0], kv[1])
+		}
+	}
+	if from.IsSet() {
+		props = appendProperty(props, propStartTime, from.expr)
+	}
+	if to.IsSet() {
+		props = appendProperty(props, propStopTime, to.expr)
+	}
+	return newSelector(s.path, s.predicate, props, s.fragment)
+}
+
+// propertiesOfList returns the list of key/value of a properties string, keeping their order.
+func propertiesOfList(s string) [][2]string {
+	result := make([][2]string, 0)
+	if len(s) > 0 {
+		for _, kv := range strings.Split(s, propSep) {
+			i := strings.Index(kv, kvSep)
+			if i < 0 {
+				result = append(result, [2]string{kv, ""})
+			} else {
+				result = append(result, [2]string{kv[:i], kv[i+1:]})
+			}
+		}
+	}
+	return result
+}
+
+func appendProperty(props string, key string, value string) string {
+	if len(props) > 0 {
+		props += propSep
+	}
+	return props + key + kvSep + value
+}
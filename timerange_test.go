@@ -0,0 +1,90 @@
+/*
+ * Copyright (c) 2017, 2020 ADLINK Technology Inc.
+ *
+ * This program and the accompanying materials are made available under the
+ * terms of the Eclipse Public License 2.0 which is available at
+ * http://www.eclipse.org/legal/epl-2.0, or the Apache License, Version 2.0
+ * which is available at https://www.apache.org/licenses/LICENSE-2.0.
+ *
+ * SPDX-License-Identifier: EPL-2.0 OR Apache-2.0
+ *
+ * Contributors:
+ *   ADLINK zenoh team, <zenoh@adlink-labs.tech>
+ */
+
+package zenoh
+
+import (
+	"testing"
+	"time"
+)
+
+func TestFromNow(t *testing.T) {
+	tests := []struct {
+		d    time.Duration
+		expr string
+	}{
+		{0, "now()"},
+		{-time.Hour, "now()-1h"},
+		{48 * time.Hour, "now()+2d"},
+		{90 * time.Second, "now()+90s"},
+		{-1500 * time.Millisecond, "now()-1500ms"},
+		// rounded to the millisecond
+		{time.Millisecond + 400*time.Microsecond, "now()+1ms"},
+		{-time.Second - 700*time.Microsecond, "now()-1001ms"},
+		{100 * time.Microsecond, "now()"},
+	}
+	for _, test := range tests {
+		if e := FromNow(test.d).ToString(); e != test.expr {
+			t.Errorf("FromNow(%v) = %q, expected %q", test.d, e, test.expr)
+		}
+	}
+	if e := Ago(time.Minute).ToString(); e != "now()-1m" {
+		t.Errorf("Ago(1m) = %q", e)
+	}
+}
+
+func TestParseTimeExpr(t *testing.T) {
+	now := time.Date(2020, 1, 2, 3, 4, 5, 0, time.UTC)
+	tests := []struct {
+		s    string
+		time time.Time
+		err  bool
+	}{
+		{"now()", now, false},
+		{"now()-1h", now.Add(-time.Hour), false},
+		{"now()+10ms", now.Add(10 * time.Millisecond), false},
+		{"2020-01-01T00:00:00Z", time.Date(2020, 1, 1, 0, 0, 0, 0, time.UTC), false},
+		{"now()-1u", time.Time{}, true},
+		{"now()-1ns", time.Time{}, true},
+		{"now()-1", time.Time{}, true},
+		{"yesterday", time.Time{}, true},
+	}
+	for _, test := range tests {
+		e, err := ParseTimeExpr(test.s)
+		if test.err {
+			if err == nil {
+				t.Errorf("ParseTimeExpr(%q) = %q, expected an error", test.s, e.ToString())
+			}
+			continue
+		}
+		if err != nil {
+			t.Errorf("ParseTimeExpr(%q) failed: %v", test.s, err)
+			continue
+		}
+		if tm, err := e.Time(now); err != nil || !tm.Equal(test.time) {
+			t.Errorf("ParseTimeExpr(%q).Time() = %v, %v, expected %v", test.s, tm, err, test.time)
+		}
+	}
+}
+
+func TestWithTimeRange(t *testing.T) {
+	s, _ := NewSelector("/a/**?x>1(starttime=now()-1d;k=v)#y")
+	from := AtTime(time.Date(2020, 1, 1, 0, 0, 0, 0, time.UTC))
+	if r := withTimeRange(s, from, TimeExpr{}).ToString(); r != "/a/**?x>1(k=v;starttime=2020-01-01T00:00:00Z)#y" {
+		t.Errorf("withTimeRange() = %q", r)
+	}
+	if r := withTimeRange(s, TimeExpr{}, Ago(time.Hour)).ToString(); r != "/a/**?x>1(k=v;stoptime=now()-1h)#y" {
+		t.Errorf("withTimeRange() = %q", r)
+	}
+}
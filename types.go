@@ -15,10 +15,14 @@
 package zenoh
 
 import (
+	"context"
+	"encoding/hex"
+	"encoding/json"
 	"fmt"
 	"regexp"
 	"strconv"
 	"strings"
+	"sync/atomic"
 
 	zcore "github.com/eclipse-zenoh/zenoh-go/core"
 	znet "github.com/eclipse-zenoh/zenoh-go/net"
@@ -27,6 +31,19 @@ import (
 // ZError reports an error that occurred in zenoh.
 type ZError = zcore.ZError
 
+// ErrorList is a list of errors. It's used as the Cause of a ZError
+// returned by an operation that can fail for several reasons (e.g. Workspace.Close()).
+type ErrorList []error
+
+// Error returns the messages of all the errors of the ErrorList
+func (el ErrorList) Error() string {
+	msgs := make([]string, len(el))
+	for i, e := range el {
+		msgs[i] = e.Error()
+	}
+	return strings.Join(msgs, "; ")
+}
+
 // Timestamp is a Zenoh Timestamp
 type Timestamp = zcore.Timestamp
 
@@ -131,13 +148,17 @@ func removeUselessSlashes(s string) string {
 // -- `field` is the name of a field in the value (is applicable and is existing. otherwise the predicate is false).
 // -- `operator` is one of a comparison operators: `<` , `>` , `<=`  , `>=`  , `=`  , `!=`.
 // -- `value` is the the value to compare the field's value with.
+// For INT and FLOAT values, the field is named "value" (e.g. "?value>1").
 //
 // - fragment: a list of fields names allowing to return a sub-part of each value.
 // This feature only applies to structured values using a "self-describing" encoding, such as JSON or XML.
 // It allows to select only some fields within the structure. A new structure with only the selected fields
 // will be used in place of the original value.
 //
-// NOTE: the filters and fragments are not yet supported in current zenoh version.
+// NOTE: the filters are not supported by the zenoh storages and evals in current zenoh version,
+// but they are evaluated on client side by Workspace.Get() and Workspace.Subscribe() (see Predicate).
+// The fragments are applied on client side as well, but only to JSON values.
+// A field name can be a path of nested fields separated by '.' (e.g. "a.b").
 type Selector struct {
 	path         string
 	predicate    string
@@ -210,11 +231,25 @@ func (s *Selector) Properties() string {
 	return s.properties
 }
 
+// Filter returns the predicate part of the Selector, parsed as a Predicate.
+// It returns an error if the predicate part is not a valid filter.
+func (s *Selector) Filter() (*Predicate, error) {
+	return ParsePredicate(s.predicate)
+}
+
 // Fragment returns the fragment part of the Selector
 func (s *Selector) Fragment() string {
 	return s.fragment
 }
 
+// FragmentFields returns the list of field names of the fragment part of the Selector
+func (s *Selector) FragmentFields() []string {
+	if len(s.fragment) == 0 {
+		return nil
+	}
+	return strings.Split(s.fragment, ";")
+}
+
 // OptionalPart returns the optional part of the Selector
 // (i.e. the part starting from the '?' character to the end of string)
 func (s *Selector) OptionalPart() string {
@@ -246,9 +281,13 @@ func (s *Selector) AddPrefix(prefix *Path) *Selector {
 // Note that zenoh makes sure that each published path/value
 // has a unique timestamp accross the system.
 type Data struct {
-	path   *Path
-	value  Value
-	tstamp *Timestamp
+	path    *Path
+	value   Value
+	tstamp  *Timestamp
+	src     []byte
+	rsn     uint64
+	srcKind SourceKind
+	err     error
 }
 
 // Path returns the path of the Data
@@ -266,6 +305,198 @@ func (e *Data) Timestamp() *Timestamp {
 	return e.tstamp
 }
 
+// Err returns the error that occurred while processing the Data, if any
+// (e.g. the fragment of the Selector couldn't be applied to its Value).
+// In such case, the Value is the one originally received.
+func (e *Data) Err() error {
+	return e.err
+}
+
+// SourceID returns the unique identifier of the storage or eval that provided the Data
+func (e *Data) SourceID() []byte {
+	return e.src
+}
+
+// RSN returns the sequence number of the reply from the storage or eval that provided the Data
+func (e *Data) RSN() uint64 {
+	return e.rsn
+}
+
+// SourceKind returns the kind of the source (storage or eval) that provided the Data
+func (e *Data) SourceKind() SourceKind {
+	return e.srcKind
+}
+
+// SourceKind is the kind of source providing a Data in reply to a query
+type SourceKind uint8
+
+const (
+	// StorageSource : the Data was provided by a storage
+	StorageSource SourceKind = iota
+	// EvalSource : the Data was provided by an eval
+	EvalSource
+)
+
+// GroupBySource groups a list of Data per source (i.e. storage or eval).
+//
+// It returns a map of the Data lists, indexed by the sources identifiers (as hexadecimal strings).
+func GroupBySource(data []Data) map[string][]Data {
+	result := make(map[string][]Data)
+	for _, d := range data {
+		src := hex.EncodeToString(d.src)
+		result[src] = append(result[src], d)
+	}
+	return result
+}
+
+// GroupByPath groups a list of Data per Path, keeping their order
+// (e.g. to get the time series of each path from the result of Workspace.GetRange()).
+//
+// It returns a map of the Data lists, indexed by the paths (as strings).
+func GroupByPath(data []Data) map[string][]Data {
+	result := make(map[string][]Data)
+	for _, d := range data {
+		p := d.path.ToString()
+		result[p] = append(result[p], d)
+	}
+	return result
+}
+
+// QueryDest indicates which storages or evals are destination of a query.
+type QueryDest uint8
+
+const (
+	// DestBestMatch : the nearest complete storages/evals if there is some, all storages/evals if not.
+	DestBestMatch QueryDest = iota
+	// DestComplete : only the complete storages/evals.
+	DestComplete
+	// DestAll : all the storages/evals.
+	DestAll
+	// DestNone : no storages/evals.
+	DestNone
+)
+
+func (d QueryDest) toZNet() znet.QueryDest {
+	switch d {
+	case DestComplete:
+		return znet.NewQueryDest(znet.ZNComplete)
+	case DestAll:
+		return znet.NewQueryDest(znet.ZNAll)
+	case DestNone:
+		return znet.NewQueryDest(znet.ZNNone)
+	default:
+		return znet.NewQueryDest(znet.ZNBestMatch)
+	}
+}
+
+// QueryTarget indicates which storages and evals matching a Selector are destination of a query.
+// Its zero value targets the best matching storages and evals.
+type QueryTarget struct {
+	Storages QueryDest
+	Evals    QueryDest
+}
+
+// Consolidation is a policy for the consolidation of the replies to a query.
+type Consolidation uint8
+
+const (
+	// ConsolidateAuto : ConsolidateNone if the Selector has a "starttime" or "stoptime" property,
+	// ConsolidateLatest otherwise.
+	ConsolidateAuto Consolidation = iota
+	// ConsolidateLatest : only the most recent Data for each Path.
+	ConsolidateLatest
+	// ConsolidateNone : all the Data, with duplicates (i.e. with same Timestamp) removed.
+	ConsolidateNone
+	// ConsolidatePerSource : the most recent Data for each Path from each storage or eval.
+	ConsolidatePerSource
+)
+
+// GetOptions configures a Workspace.GetWithOptions() call.
+type GetOptions struct {
+	// Target indicates which storages and evals are queried.
+	Target QueryTarget
+
+	// Consolidation is the policy used to consolidate the replies.
+	Consolidation Consolidation
+}
+
+// StreamOptions configures a Workspace.GetStream() call.
+type StreamOptions struct {
+	// Target indicates which storages and evals are queried.
+	Target QueryTarget
+
+	// BufferSize is the capacity of the channel returned by DataStream.C().
+	BufferSize int
+
+	// Consolidate makes the stream drop each Data which Timestamp is not more recent
+	// than the last Data provided for the same Path (e.g. the duplicates received
+	// from several storages).
+	Consolidate bool
+}
+
+// DataStream is a stream of Data returned by Workspace.GetStream().
+type DataStream struct {
+	c           chan Data
+	err         error
+	ctx         context.Context
+	cancel      context.CancelFunc
+	closed      int32
+	consolidate bool
+	lastTs      map[Path]*Timestamp // accessed by the I/O subroutine only
+}
+
+// newDataStream returns a DataStream configured by opts, ending when ctx is done.
+func newDataStream(ctx context.Context, opts *StreamOptions) *DataStream {
+	ctx, cancel := context.WithCancel(ctx)
+	return &DataStream{make(chan Data, opts.BufferSize), nil, ctx, cancel, 0, opts.Consolidate,
+		make(map[Path]*Timestamp)}
+}
+
+// C returns the channel providing the Data as soon as they're received.
+// The channel is closed when the stream ends.
+func (ds *DataStream) C() <-chan Data {
+	return ds.c
+}
+
+// Err returns the error that ended the stream, if any.
+// It must be called only once the channel returned by C() has been closed.
+// It returns nil if the stream has been ended by Close().
+func (ds *DataStream) Err() error {
+	return ds.err
+}
+
+// Close ends the stream, without waiting for the remaining replies.
+func (ds *DataStream) Close() {
+	atomic.StoreInt32(&ds.closed, 1)
+	ds.cancel()
+}
+
+// push provides a Data received in reply via the stream's channel, waiting for some room
+// in the channel until the stream is closed or its context done.
+func (ds *DataStream) push(d *Data) {
+	if ds.consolidate {
+		if ts, ok := ds.lastTs[*d.path]; ok && !ts.Before(d.tstamp) {
+			return
+		}
+		ds.lastTs[*d.path] = d.tstamp
+	}
+	select {
+	case ds.c <- *d:
+	case <-ds.ctx.Done():
+	}
+}
+
+// end ends the stream of the query on the Selector s, with the query's error and
+// the errors replied by the evals. The query's error is ignored if the stream has been closed.
+func (ds *DataStream) end(s *Selector, queryErr error, evalErrs ErrorList) {
+	if atomic.LoadInt32(&ds.closed) != 0 {
+		queryErr = nil
+	}
+	ds.err = joinGetErrors(s, queryErr, evalErrs)
+	ds.cancel()
+	close(ds.c)
+}
+
 ////////////////
 //   Change   //
 ////////////////
@@ -291,6 +522,7 @@ type Change struct {
 	kind      ChangeKind
 	timestamp *Timestamp
 	value     Value
+	err       error
 }
 
 // Path returns the path impacted by the change
@@ -313,6 +545,13 @@ func (c *Change) Value() Value {
 	return c.value
 }
 
+// Err returns the error that occurred while processing the Change, if any
+// (e.g. the fragment of the Selector couldn't be applied to its Value).
+// In such case, the Value is the one originally received.
+func (c *Change) Err() error {
+	return c.err
+}
+
 ////////////////
 //  Encoding  //
 ////////////////
@@ -360,7 +599,7 @@ func init() {
 	RegisterValueDecoder(RAW, rawDecoder)
 	RegisterValueDecoder(STRING, stringDecoder)
 	RegisterValueDecoder(PROPERTIES, propertiesDecoder)
-	RegisterValueDecoder(JSON, stringDecoder)
+	RegisterValueDecoder(JSON, jsonDecoder)
 	RegisterValueDecoder(INT, intDecoder)
 	RegisterValueDecoder(FLOAT, floatDecoder)
 }
@@ -451,6 +690,55 @@ func stringDecoder(buf []byte) (Value, error) {
 	return &StringValue{string(buf)}, nil
 }
 
+////////////////////
+//   JSON Value   //
+////////////////////
+
+// JSONValue is a JSON value (i.e. a JSON structure in an UTF-8 string)
+//
+// The JSON values received from Zenoh are decoded as *JSONValue.
+// Note that they used to be decoded as *StringValue: the code asserting such type on JSON
+// values must assert *JSONValue instead, or use Value.ToString().
+type JSONValue struct {
+	raw []byte
+}
+
+// NewJSONValue returns a new JSONValue holding the JSON encoding of v (see json.Marshal()).
+func NewJSONValue(v interface{}) (*JSONValue, error) {
+	raw, err := json.Marshal(v)
+	if err != nil {
+		return nil, &ZError{Msg: "JSON encoding failed", Code: 0, Cause: err}
+	}
+	return &JSONValue{raw}, nil
+}
+
+// Encoding returns the encoding flag for a JSONValue
+func (v *JSONValue) Encoding() Encoding {
+	return JSON
+}
+
+// Encode returns the value encoded as a []byte
+func (v *JSONValue) Encode() []byte {
+	return v.raw
+}
+
+// ToString returns the value as a string
+func (v *JSONValue) ToString() string {
+	return string(v.raw)
+}
+
+func jsonDecoder(buf []byte) (Value, error) {
+	return &JSONValue{buf}, nil
+}
+
+// Unmarshal decodes the JSON value into the value pointed to by into (see json.Unmarshal()).
+func (v *JSONValue) Unmarshal(into interface{}) error {
+	if err := json.Unmarshal(v.raw, into); err != nil {
+		return &ZError{Msg: "JSON decoding failed", Code: 0, Cause: err}
+	}
+	return nil
+}
+
 //////////////////////////
 //   PROPERTIES Value   //
 //////////////////////////
@@ -0,0 +1,58 @@
+/*
+ * Copyright (c) 2017, 2020 ADLINK Technology Inc.
+ *
+ * This program and the accompanying materials are made available under the
+ * terms of the Eclipse Public License 2.0 which is available at
+ * http://www.eclipse.org/legal/epl-2.0, or the Apache License, Version 2.0
+ * which is available at https://www.apache.org/licenses/LICENSE-2.0.
+ *
+ * SPDX-License-Identifier: EPL-2.0 OR Apache-2.0
+ *
+ * Contributors:
+ *   ADLINK zenoh team, <zenoh@adlink-labs.tech>
+ */
+
+package zenoh
+
+import (
+	"testing"
+)
+
+type testJSON struct {
+	Name  string `json:"name"`
+	Count int    `json:"count"`
+}
+
+func TestJSONValue(t *testing.T) {
+	v, err := NewJSONValue(testJSON{"a", 1})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if v.Encoding() != JSON || v.ToString() != `{"name":"a","count":1}` {
+		t.Errorf("encoded %v as %s", v.Encoding(), v.ToString())
+	}
+
+	// the JSON values are decoded as *JSONValue
+	decoded, err := valueDecoders[JSON](v.Encode())
+	if err != nil {
+		t.Fatal(err)
+	}
+	jv, ok := decoded.(*JSONValue)
+	if !ok {
+		t.Fatalf("decoded as %T", decoded)
+	}
+	var into testJSON
+	if err := jv.Unmarshal(&into); err != nil {
+		t.Fatal(err)
+	}
+	if into != (testJSON{"a", 1}) {
+		t.Errorf("unmarshalled %v", into)
+	}
+
+	if err := (&JSONValue{[]byte("{")}).Unmarshal(&into); err == nil {
+		t.Error("unmarshalled invalid JSON")
+	}
+	if _, err := NewJSONValue(make(chan int)); err == nil {
+		t.Error("encoded a channel")
+	}
+}
@@ -15,9 +15,13 @@
 package zenoh
 
 import (
+	"bytes"
+	"context"
 	"sort"
 	"strings"
 	"sync"
+	"sync/atomic"
+	"time"
 
 	zcore "github.com/eclipse-zenoh/zenoh-go/core"
 	znet "github.com/eclipse-zenoh/zenoh-go/net"
@@ -26,10 +30,121 @@ import (
 
 // Workspace allows to operate on Zenoh.
 type Workspace struct {
-	path          *Path
-	session       *znet.Session
-	evals         map[Path]*znet.Eval
-	useSubroutine bool
+	z        *Zenoh
+	path     *Path
+	session  *znet.Session
+	executor *executor
+	autoPub  *autoPublishers
+
+	mu          *sync.Mutex
+	evals       map[string]*registeredEval
+	storages    map[string]*registeredStorage
+	subs        map[*SubscriptionID]func() // the function called when unsubscribed, if any
+	pubs        map[*Publisher]bool
+	middlewares atomic.Value // the Middleware chaining the middlewares added by Use(), if any
+	tracked     bool
+	closed      bool
+}
+
+// newWorkspace returns a new Workspace. If executor is nil, the listeners
+// and eval callbacks are executed by the I/O subroutine.
+func newWorkspace(z *Zenoh, path *Path, executor *executor) *Workspace {
+	return &Workspace{
+		z:        z,
+		path:     path,
+		session:  z.session,
+		executor: executor,
+		autoPub:  newAutoPublishers(z.session),
+		mu:       new(sync.Mutex),
+		evals:    make(map[string]*registeredEval),
+		storages: make(map[string]*registeredStorage),
+		subs:     make(map[*SubscriptionID]func()),
+		pubs:     make(map[*Publisher]bool),
+	}
+}
+
+// track makes the Zenoh aware of the Workspace, for Logout to close it.
+// It returns an error if the Workspace is closed.
+// w.mu must be locked by the caller.
+func (w *Workspace) track() error {
+	if w.closed {
+		return &ZError{Msg: "Workspace on " + w.path.ToString() + " is closed", Code: 0, Cause: nil}
+	}
+	if !w.tracked {
+		w.z.track(w)
+		w.tracked = true
+	}
+	return nil
+}
+
+// Close releases all the subscriptions, evals, storages and publishers declared via the Workspace,
+// after waiting for the listeners and eval callbacks queued in its executor (if any).
+// The ChanSubscriptions and Caches of the Workspace are closed.
+// The Workspace cannot be used for further subscriptions or evals registrations.
+//
+// Close must not be called by a listener or an eval callback executed by the Workspace's executor,
+// since it waits for them to return. Call it from another subroutine instead (e.g. go w.Close()).
+func (w *Workspace) Close() error {
+	logger.WithField("path", w.path).Debug("Close")
+	w.mu.Lock()
+	if w.closed {
+		w.mu.Unlock()
+		return nil
+	}
+	w.closed = true
+	subs, evals, storages, pubs := w.subs, w.evals, w.storages, w.pubs
+	w.subs = make(map[*SubscriptionID]func())
+	w.evals = make(map[string]*registeredEval)
+	w.storages = make(map[string]*registeredStorage)
+	w.pubs = make(map[*Publisher]bool)
+	tracked := w.tracked
+	w.mu.Unlock()
+
+	// the queued listeners and eval callbacks are executed while the subscriptions,
+	// evals and storages are still declared, the eval callbacks in progress being cancelled
+	for _, re := range evals {
+		re.cancel()
+	}
+	for _, rs := range storages {
+		rs.sh.stop()
+	}
+	if w.executor != nil {
+		w.executor.shutdown()
+	}
+
+	errs := make(ErrorList, 0)
+	for sub, onClose := range subs {
+		if err := w.session.UndeclareSubscriber(sub); err != nil {
+			errs = append(errs, err)
+		}
+		if onClose != nil {
+			onClose()
+		}
+	}
+	for expr, re := range evals {
+		if err := w.session.UndeclareEval(re.zeval); err != nil {
+			errs = append(errs, &ZError{Msg: "UnregisterEval on " + expr + " failed", Code: 0, Cause: err})
+		}
+	}
+	for sel, rs := range storages {
+		if err := w.session.UndeclareStorage(rs.zsto); err != nil {
+			errs = append(errs, &ZError{Msg: "UnregisterStorage on " + sel + " failed", Code: 0, Cause: err})
+		}
+	}
+	for pub := range pubs {
+		if err := pub.undeclare(); err != nil {
+			errs = append(errs, &ZError{Msg: "Close of Publisher on " + pub.path.ToString() + " failed", Code: 0, Cause: err})
+		}
+	}
+	errs = append(errs, w.autoPub.close()...)
+	if tracked {
+		w.z.untrack(w)
+	}
+
+	if len(errs) > 0 {
+		return &ZError{Msg: "Close of Workspace on " + w.path.ToString() + " failed", Code: 0, Cause: errs}
+	}
+	return nil
 }
 
 // Put a path/value into Zenoh.
@@ -39,7 +154,7 @@ func (w *Workspace) Put(path *Path, value Value) error {
 		"value": value,
 	}).Debug("Put")
 	p := w.toAbsolutePath(path)
-	if e := w.session.WriteDataWO(p.ToString(), value.Encode(), value.Encoding(), PUT); e != nil {
+	if e := w.write(p, value.Encode(), value.Encoding(), PUT); e != nil {
 		return &ZError{Msg: "Put on " + p.ToString() + " failed", Code: 0, Cause: e}
 	}
 	return nil
@@ -52,7 +167,7 @@ func (w *Workspace) PutBytes(path *Path, value []byte) error {
 		"value": value,
 	}).Debug("PutBytes")
 	p := w.toAbsolutePath(path)
-	if e := w.session.WriteDataWO(p.ToString(), value, RAW, PUT); e != nil {
+	if e := w.write(p, value, RAW, PUT); e != nil {
 		return &ZError{Msg: "PutBytes on " + p.ToString() + " failed", Code: 0, Cause: e}
 	}
 	return nil
@@ -65,7 +180,7 @@ func (w *Workspace) PutString(path *Path, value string) error {
 		"value": value,
 	}).Debug("PutString")
 	p := w.toAbsolutePath(path)
-	if e := w.session.WriteDataWO(p.ToString(), stringEncoder(value), STRING, PUT); e != nil {
+	if e := w.write(p, stringEncoder(value), STRING, PUT); e != nil {
 		return &ZError{Msg: "PutString on " + p.ToString() + " failed", Code: 0, Cause: e}
 	}
 	return nil
@@ -78,7 +193,7 @@ func (w *Workspace) PutInt(path *Path, value int64) error {
 		"value": value,
 	}).Debug("PutInt")
 	p := w.toAbsolutePath(path)
-	if e := w.session.WriteDataWO(p.ToString(), intEncoder(value), INT, PUT); e != nil {
+	if e := w.write(p, intEncoder(value), INT, PUT); e != nil {
 		return &ZError{Msg: "PutInt on " + p.ToString() + " failed", Code: 0, Cause: e}
 	}
 	return nil
@@ -91,12 +206,29 @@ func (w *Workspace) PutFloat(path *Path, value float64) error {
 		"value": value,
 	}).Debug("PutFloat")
 	p := w.toAbsolutePath(path)
-	if e := w.session.WriteDataWO(p.ToString(), floatEncoder(value), FLOAT, PUT); e != nil {
+	if e := w.write(p, floatEncoder(value), FLOAT, PUT); e != nil {
 		return &ZError{Msg: "PutFloat on " + p.ToString() + " failed", Code: 0, Cause: e}
 	}
 	return nil
 }
 
+// PutJSON a path/JSON value into Zenoh, with value encoded as JSON (see NewJSONValue()).
+func (w *Workspace) PutJSON(path *Path, value interface{}) error {
+	logger.WithFields(log.Fields{
+		"path":  path,
+		"value": value,
+	}).Debug("PutJSON")
+	p := w.toAbsolutePath(path)
+	v, err := NewJSONValue(value)
+	if err != nil {
+		return &ZError{Msg: "PutJSON on " + p.ToString() + " failed", Code: 0, Cause: err}
+	}
+	if e := w.write(p, v.Encode(), JSON, PUT); e != nil {
+		return &ZError{Msg: "PutJSON on " + p.ToString() + " failed", Code: 0, Cause: e}
+	}
+	return nil
+}
+
 // Update a path/value into Zenoh.
 func (w *Workspace) Update(path *Path, value Value) error {
 	logger.WithFields(log.Fields{
@@ -104,7 +236,7 @@ func (w *Workspace) Update(path *Path, value Value) error {
 		"value": value,
 	}).Debug("Update")
 	p := w.toAbsolutePath(path)
-	if e := w.session.WriteDataWO(p.ToString(), value.Encode(), value.Encoding(), UPDATE); e != nil {
+	if e := w.write(p, value.Encode(), value.Encoding(), UPDATE); e != nil {
 		return &ZError{Msg: "Put on " + path.ToString() + " failed", Code: 0, Cause: e}
 	}
 	return nil
@@ -114,7 +246,7 @@ func (w *Workspace) Update(path *Path, value Value) error {
 func (w *Workspace) Remove(path *Path) error {
 	logger.WithField("path", path).Debug("Remove")
 	p := w.toAbsolutePath(path)
-	if e := w.session.WriteDataWO(p.ToString(), nil, 0, REMOVE); e != nil {
+	if e := w.write(p, nil, 0, REMOVE); e != nil {
 		return &ZError{Msg: "Put on " + path.ToString() + " failed", Code: 0, Cause: e}
 	}
 	return nil
@@ -154,113 +286,185 @@ func (ds dataset) asSortedSet() dataset {
 // isSelectorForSeries returns true if the selector implies time series within reply
 func isSelectorForSeries(selector *Selector) bool {
 	// search for starttime or stoptime property in selector
-	props := strings.Split(selector.Properties(), ";")
-	for _, p := range props {
-		if strings.HasPrefix(p, "starttime") || strings.HasPrefix(p, "stoptime") {
-			return true
-		}
-	}
-	return false
+	props := propertiesOfString(selector.Properties())
+	_, hasStart := props[propStartTime]
+	_, hasStop := props[propStopTime]
+	return hasStart || hasStop
 }
 
 // Get a selection of path/value from Zenoh.
+//
+// The errors returned by the evals (see RegisterDataEval()) are logged.
+// Use GetWithContext() to get them.
 func (w *Workspace) Get(selector *Selector) []Data {
+	results, err := w.GetWithContext(context.Background(), selector)
+	if err != nil {
+		logger.WithFields(log.Fields{
+			"selector": selector,
+			"error":    err,
+		}).Warn("Get failed")
+	}
+	return results
+}
+
+// GetJSON gets the JSON value of a path from Zenoh and decodes it into the value pointed to
+// by into (see JSONValue.Unmarshal()). If several values are received for the path,
+// the one with the most recent Timestamp is decoded.
+// It stops waiting for the values as soon as ctx is done, as GetWithContext() does.
+//
+// An error is returned if no value is found, or if the value is not a JSONValue.
+func (w *Workspace) GetJSON(ctx context.Context, path *Path, into interface{}) error {
+	p := w.toAbsolutePath(path)
+	s, err := NewSelector(p.ToString())
+	if err != nil {
+		return &ZError{Msg: "GetJSON on " + p.ToString() + " failed", Code: 0, Cause: err}
+	}
+	results, evalErrs, err := w.getWithEvalErrors(ctx, s, nil)
+	if err != nil {
+		return &ZError{Msg: "GetJSON on " + p.ToString() + " failed", Code: 0, Cause: err}
+	}
+	return unmarshalLatestJSON(p, results, evalErrs, into)
+}
+
+// unmarshalLatestJSON decodes into the JSON value with the most recent Timestamp among results.
+func unmarshalLatestJSON(p *Path, results []Data, evalErrs ErrorList, into interface{}) error {
+	var latest *Data
+	for i := range results {
+		d := &results[i]
+		if latest == nil || latest.Timestamp().Before(d.Timestamp()) {
+			latest = d
+		}
+	}
+	if latest == nil {
+		if len(evalErrs) > 0 {
+			return &ZError{Msg: "GetJSON on " + p.ToString() + " failed", Code: 0, Cause: evalErrs}
+		}
+		return &ZError{Msg: "GetJSON on " + p.ToString() + " failed: no value found", Code: 0, Cause: nil}
+	}
+	v, ok := latest.Value().(*JSONValue)
+	if !ok {
+		return &ZError{Msg: "GetJSON on " + p.ToString() + " failed: value is not JSON", Code: 0, Cause: nil}
+	}
+	if err := v.Unmarshal(into); err != nil {
+		return &ZError{Msg: "GetJSON on " + p.ToString() + " failed", Code: 0, Cause: err}
+	}
+	return nil
+}
+
+// GetWithContext gets a selection of path/value from Zenoh, as Get() does,
+// but stops waiting for the replies as soon as ctx is done.
+//
+// If the query cannot be issued, an error is returned.
+// If ctx is done before the final reply is received, the Data received so far
+// are returned with a *ZError having ctx.Err() as Cause.
+// If some evals replied an error (see RegisterDataEval()), the Data received are returned
+// with a *ZError having an ErrorList as Cause, with these errors (and the ctx error, if any).
+func (w *Workspace) GetWithContext(ctx context.Context, selector *Selector) ([]Data, error) {
+	return w.GetWithOptions(ctx, selector, nil)
+}
+
+// GetWithOptions gets a selection of path/value from Zenoh, as GetWithContext() does,
+// but querying the storages and evals, and consolidating the replies, as specified by opts.
+// If opts is nil, the default GetOptions are used.
+func (w *Workspace) GetWithOptions(ctx context.Context, selector *Selector, opts *GetOptions) ([]Data, error) {
 	s := w.toAbsoluteSelector(selector)
-	logger := logger.WithField("selector", s)
-	logger.Debug("Get")
+	results, evalErrs, err := w.getWithEvalErrors(ctx, s, opts)
+	return results, joinGetErrors(s, err, evalErrs)
+}
 
-	qresults := make(map[Path]dataset)
-	queryFinished := false
+// getWithEvalErrors gets a selection of path/value from Zenoh, as GetWithOptions() does,
+// but returns the errors replied by the evals apart from the error of the query.
+func (w *Workspace) getWithEvalErrors(ctx context.Context, s *Selector, opts *GetOptions) ([]Data, ErrorList, error) {
+	logger.WithField("selector", s).Debug("Get")
 
-	mu := new(sync.Mutex)
-	cond := sync.NewCond(mu)
+	var results []Data
+	var evalErrs ErrorList
+	var queryErr error
+	err := w.intercept(&Invocation{Op: OpGet, Target: s.ToString(), Context: ctx}, func() error {
+		results, evalErrs, queryErr = w.get(ctx, s, opts)
+		return joinGetErrors(s, queryErr, evalErrs)
+	})
+	if err != nil && queryErr == nil && len(evalErrs) == 0 {
+		// error raised by a middleware
+		queryErr = err
+	}
+	return results, evalErrs, queryErr
+}
 
-	replyCb := func(reply *znet.ReplyValue) {
-		switch reply.Kind() {
-		case znet.ZNStorageData, znet.ZNEvalData:
-			path, err := NewPath(reply.RName())
-			if err != nil {
-				logger.WithField("reply path", reply.RName()).
-					Warn("Get received reply for an invalid path")
-				return
-			}
-			data := reply.Data()
-			info := reply.Info()
-			encoding := info.Encoding()
-			if reply.Kind() == znet.ZNStorageData {
-				logger.WithFields(log.Fields{
-					"reply path": reply.RName(),
-					"len(data)":  len(data),
-					"encoding":   encoding,
-				}).Trace("Get => ZN_STORAGE_DATA")
-			} else {
-				logger.WithFields(log.Fields{
-					"reply path": reply.RName(),
-					"len(data)":  len(data),
-					"encoding":   encoding,
-				}).Trace("Get => ZN_EVAL_DATA")
-			}
+// joinGetErrors returns the error of a Get, given the error of its query and the errors replied by the evals.
+func joinGetErrors(s *Selector, queryErr error, evalErrs ErrorList) error {
+	if len(evalErrs) == 0 {
+		return queryErr
+	}
+	errs := evalErrs
+	if queryErr != nil {
+		errs = append(ErrorList{queryErr}, evalErrs...)
+	}
+	return &ZError{Msg: "Get on " + s.ToString() + " received errors from evals", Code: 0, Cause: errs}
+}
 
-			decoder, ok := valueDecoders[encoding]
-			if !ok {
-				logger.WithFields(log.Fields{
-					"reply path": reply.RName(),
-					"encoding":   encoding,
-				}).Warn("Get : no Decoder found for reply")
-				return
-			}
-			value, err := decoder(data)
-			if err != nil {
-				logger.WithFields(log.Fields{
-					"reply path": reply.RName(),
-					"encoding":   encoding,
-					"error":      err,
-				}).Warn("Get : error decoding reply")
-				return
-			}
-			ts := info.Tstamp()
-			// @TODO: remove this when we're sure Data always come with a Timestamp.
-			if ts == nil {
-				ts = zcore.GenerateTimestamp()
-			}
-			d := Data{path, value, ts}
-			l, _ := qresults[*path]
-			qresults[*path] = append(l, d)
-
-		case znet.ZNStorageFinal:
-			logger.Trace("Get => ZN_STORAGE_FINAL")
-
-		case znet.ZNEvalFinal:
-			logger.Trace("Get => ZN_EVAL_FINAL")
-
-		case znet.ZNReplyFinal:
-			logger.WithField("nb replies", len(qresults)).Trace("Get => ZN_REPLY_FINAL")
-			queryFinished = true
-			mu.Lock()
-			defer mu.Unlock()
-			cond.Signal()
+// get issues a query on the absolute Selector s, and consolidates the replies as specified by opts.
+// It returns the errors replied by the evals apart from the error of the query.
+func (w *Workspace) get(ctx context.Context, s *Selector, opts *GetOptions) ([]Data, ErrorList, error) {
+	if opts == nil {
+		opts = new(GetOptions)
+	}
+	rc := newReplyCollector(s, opts.Consolidation)
+	evalErrs := make(ErrorList, 0)
+	err := w.query(ctx, s, opts.Target, rc.add, func(err error) {
+		evalErrs = append(evalErrs, err)
+	})
+	if len(evalErrs) == 0 {
+		evalErrs = nil
+	}
+	if err != nil && len(rc.datasets) == 0 {
+		return nil, evalErrs, err
+	}
+	return rc.results(), evalErrs, err
+}
+
+// replyCollector collects the Data received in reply to a query,
+// to consolidate them according to a Consolidation policy.
+type replyCollector struct {
+	consolidation Consolidation
+	datasets      map[datasetKey]dataset
+}
+
+// newReplyCollector returns a replyCollector for a query on the Selector s,
+// resolving ConsolidateAuto according to s.
+func newReplyCollector(s *Selector, consolidation Consolidation) *replyCollector {
+	if consolidation == ConsolidateAuto {
+		if isSelectorForSeries(s) {
+			consolidation = ConsolidateNone
+		} else {
+			consolidation = ConsolidateLatest
 		}
 	}
+	return &replyCollector{consolidation, make(map[datasetKey]dataset)}
+}
 
-	mu.Lock()
-	defer mu.Unlock()
-	w.session.Query(s.Path(), s.OptionalPart(), replyCb)
-	for !queryFinished {
-		cond.Wait()
+func (rc *replyCollector) add(d *Data) {
+	key := datasetKey{path: *d.path}
+	if rc.consolidation == ConsolidatePerSource {
+		key.src = string(d.src)
 	}
+	rc.datasets[key] = append(rc.datasets[key], *d)
+}
 
+// results returns the consolidated Data.
+func (rc *replyCollector) results() []Data {
 	results := make([]Data, 0)
-	if isSelectorForSeries(selector) {
+	if rc.consolidation == ConsolidateNone {
 		// return all data
-		for _, dataset := range qresults {
+		for _, dataset := range rc.datasets {
 			dataset = dataset.asSortedSet()
 			for _, d := range dataset {
 				results = append(results, d)
 			}
 		}
 	} else {
-		// return only the latest data for each path
-		for _, dataset := range qresults {
+		// return only the latest data for each path (and source)
+		for _, dataset := range rc.datasets {
 			dataset = dataset.asSortedSet()
 			d := dataset[len(dataset)-1]
 			results = append(results, d)
@@ -269,14 +473,428 @@ func (w *Workspace) Get(selector *Selector) []Data {
 	return results
 }
 
+// GetRange gets all the values of a selection of paths stored during a time range
+// (i.e. with a Timestamp between from and to).
+// from or to can be the zero time.Time, for a range without lower or upper bound.
+//
+// The returned Data are sorted by Timestamp. Use GroupByPath() to get the time series for each path.
+// ctx is used as in GetWithContext().
+func (w *Workspace) GetRange(ctx context.Context, selector *Selector, from time.Time, to time.Time) ([]Data, error) {
+	var fromExpr, toExpr TimeExpr
+	if !from.IsZero() {
+		fromExpr = AtTime(from)
+	}
+	if !to.IsZero() {
+		toExpr = AtTime(to)
+	}
+	return w.GetRangeExpr(ctx, selector, fromExpr, toExpr)
+}
+
+// GetRangeExpr gets all the values of a selection of paths stored during a time range, as GetRange() does,
+// but with bounds that can be relative to the time at which the storages process the query (e.g. Ago(time.Hour)).
+// from or to can be the zero TimeExpr, for a range without lower or upper bound.
+func (w *Workspace) GetRangeExpr(ctx context.Context, selector *Selector, from TimeExpr, to TimeExpr) ([]Data, error) {
+	s := withTimeRange(selector, from, to)
+	results, err := w.GetWithOptions(ctx, s, &GetOptions{Consolidation: ConsolidateNone})
+	sort.Sort(dataset(results))
+	return results, err
+}
+
+// datasetKey identifies the dataset a Data is added to by GetWithOptions().
+type datasetKey struct {
+	path Path
+	src  string
+}
+
+// GetStream gets a selection of path/value from Zenoh, as Get() does,
+// but provides each Data via the returned DataStream as soon as it's received.
+//
+// The stream ends when the final reply is received or when ctx is done.
+// The errors replied by the evals are reported by DataStream.Err(), as GetWithContext() does.
+// The Data must be consumed from DataStream.C(), or the stream closed,
+// since the I/O subroutine is blocked while the stream's channel is full.
+func (w *Workspace) GetStream(ctx context.Context, selector *Selector, opts *StreamOptions) (*DataStream, error) {
+	s := w.toAbsoluteSelector(selector)
+	logger.WithField("selector", s).Debug("GetStream")
+
+	if opts == nil {
+		opts = new(StreamOptions)
+	}
+	ds := newDataStream(ctx, opts)
+
+	// accessed by the I/O subroutine until the query is finished or released
+	evalErrs := make(ErrorList, 0)
+	onError := func(err error) {
+		evalErrs = append(evalErrs, err)
+	}
+
+	var pq *pendingQuery
+	err := w.intercept(&Invocation{Op: OpGet, Target: s.ToString(), Context: ds.ctx}, func() error {
+		var err error
+		pq, err = w.startQuery(s, opts.Target, ds.push, onError)
+		return err
+	})
+	if err != nil {
+		ds.cancel()
+		return nil, err
+	}
+	go func() {
+		ds.end(s, pq.wait(ds.ctx), evalErrs)
+	}()
+	return ds, nil
+}
+
+// query issues a query on the absolute Selector s and calls onData for each Data
+// received in reply, and onError for each error replied by an eval, until the final
+// reply is received or ctx is done.
+// onData and onError are called by the I/O subroutine and are never called after query returned.
+func (w *Workspace) query(ctx context.Context, s *Selector, target QueryTarget, onData func(*Data), onError func(error)) error {
+	pq, err := w.startQuery(s, target, onData, onError)
+	if err != nil {
+		return err
+	}
+	return pq.wait(ctx)
+}
+
+// propExtReplies is a Selector property added by the Workspace to its queries, to indicate that
+// the querier supports the replies that zenoh-net doesn't define, which the zenoh-go evals and
+// storages send only to such queriers (i.e. the errors of the evals, see RegisterDataEval(),
+// and the values of the storages with their Timestamp, see RegisterStorage()).
+// See the package documentation for the format of such replies.
+const propExtReplies = "_zgo"
+
+// extReplyMagic prefixes the data of the replies sent to the queriers having the propExtReplies
+// property, when zenoh-net cannot carry their content. It's followed by a tag telling what the
+// remaining data is.
+var extReplyMagic = []byte("\x00zgo")
+
+// The tags following extReplyMagic.
+const (
+	// extReplyValue : the value, which data starts with extReplyMagic.
+	extReplyValue byte = 'v'
+	// extReplyTimestamped : the Timestamp of the value (see encodeTimestamp()), then the value.
+	extReplyTimestamped byte = 't'
+	// extReplyEvalError : the JSON-encoded error returned by an eval.
+	extReplyEvalError byte = 'e'
+)
+
+// extReplyData returns the data of a reply with the tag, followed by the parts of the payload.
+func extReplyData(tag byte, payload ...[]byte) []byte {
+	size := len(extReplyMagic) + 1
+	for _, p := range payload {
+		size += len(p)
+	}
+	buf := make([]byte, 0, size)
+	buf = append(append(buf, extReplyMagic...), tag)
+	for _, p := range payload {
+		buf = append(buf, p...)
+	}
+	return buf
+}
+
+// plainReplyData returns the data of a reply with a value encoded as data,
+// escaping it if it starts with extReplyMagic.
+func plainReplyData(data []byte) []byte {
+	if bytes.HasPrefix(data, extReplyMagic) {
+		return extReplyData(extReplyValue, data)
+	}
+	return data
+}
+
+// decodeExtReply returns the tag and the payload of the data of a reply, and false if the data
+// doesn't start with extReplyMagic.
+func decodeExtReply(data []byte) (byte, []byte, bool) {
+	if len(data) <= len(extReplyMagic) || !bytes.HasPrefix(data, extReplyMagic) {
+		return 0, data, false
+	}
+	return data[len(extReplyMagic)], data[len(extReplyMagic)+1:], true
+}
+
+// withExtReplies returns the Selector s with the propExtReplies property.
+func withExtReplies(s *Selector) *Selector {
+	if _, ok := propertiesOfString(s.properties)[propExtReplies]; ok {
+		return s
+	}
+	return newSelector(s.path, s.predicate, appendProperty(s.properties, propExtReplies, "1"), s.fragment)
+}
+
+// withoutExtReplies returns the Selector s without the propExtReplies property,
+// and true if s had this property.
+func withoutExtReplies(s *Selector) (*Selector, bool) {
+	props, found := "", false
+	for _, kv := range propertiesOfList(s.properties) {
+		if kv[0] == propExtReplies {
+			found = true
+		} else {
+			props = appendProperty(props, kv[0], kv[1])
+		}
+	}
+	if !found {
+		return s, false
+	}
+	return newSelector(s.path, s.predicate, props, s.fragment), true
+}
+
+// pendingQuery is a query issued by Workspace.startQuery(), and waiting for its final reply.
+type pendingQuery struct {
+	s        *Selector
+	logger   *log.Entry
+	filter   *Predicate
+	fields   []string
+	onData   func(*Data)
+	onError  func(error)
+	release  func() // releases the zenoh-net query
+	mu       *sync.Mutex
+	released bool
+	finished chan struct{}
+}
+
+// startQuery issues a query on the absolute Selector s to the storages and evals specified by target,
+// and calls onData for each Data received in reply, and onError for each error replied by an eval,
+// until the final reply is received or the query is released by wait().
+func (w *Workspace) startQuery(s *Selector, target QueryTarget, onData func(*Data), onError func(error)) (*pendingQuery, error) {
+	pq, err := newPendingQuery(s, onData, onError)
+	if err != nil {
+		return nil, err
+	}
+	q, err := w.session.StartQuery(s.Path(), withExtReplies(s).OptionalPart(),
+		func(reply *znet.ReplyValue) { pq.handle(queryReplyOf(reply)) },
+		target.Storages.toZNet(), target.Evals.toZNet())
+	if err != nil {
+		return nil, &ZError{Msg: "Get on " + s.ToString() + " failed", Code: 0, Cause: err}
+	}
+	pq.release = func() { w.session.ReleaseQuery(q) }
+	return pq, nil
+}
+
+func newPendingQuery(s *Selector, onData func(*Data), onError func(error)) (*pendingQuery, error) {
+	filter, err := s.Filter()
+	if err != nil {
+		return nil, &ZError{Msg: "Get on " + s.ToString() + " failed", Code: 0, Cause: err}
+	}
+	return &pendingQuery{s, logger.WithField("selector", s), filter, s.FragmentFields(), onData, onError,
+		nil, new(sync.Mutex), false, make(chan struct{})}, nil
+}
+
+// handle processes a reply to the query. It's called by the I/O subroutine.
+func (pq *pendingQuery) handle(reply *queryReply) {
+	pq.mu.Lock()
+	defer pq.mu.Unlock()
+	if pq.released {
+		return
+	}
+	switch reply.kind {
+	case znet.ZNStorageData, znet.ZNEvalData:
+		d := decodeReply(pq.logger, reply)
+		if d == nil {
+			return
+		}
+		if d.value == nil {
+			// error replied by an eval
+			pq.onError(d.err)
+			return
+		}
+		if !pq.filter.match(reply.encoding, d.value) {
+			pq.logger.WithField("reply path", d.path).Trace("Get : reply filtered out by predicate")
+			return
+		}
+		if pq.fields != nil {
+			if v, err := projectValue(d.path, reply.encoding, d.value, pq.fields); err != nil {
+				d.err = err
+			} else {
+				d.value = v
+			}
+		}
+		pq.onData(d)
+
+	case znet.ZNStorageFinal:
+		pq.logger.Trace("Get => ZN_STORAGE_FINAL")
+
+	case znet.ZNEvalFinal:
+		pq.logger.Trace("Get => ZN_EVAL_FINAL")
+
+	case znet.ZNReplyFinal:
+		pq.logger.Trace("Get => ZN_REPLY_FINAL")
+		pq.released = true
+		close(pq.finished)
+	}
+}
+
+// wait waits for the final reply of the query, or for ctx to be done.
+// In the latter case, the query is released and onData won't be called anymore.
+func (pq *pendingQuery) wait(ctx context.Context) error {
+	select {
+	case <-pq.finished:
+		return nil
+	case <-ctx.Done():
+		pq.mu.Lock()
+		pq.released = true
+		pq.mu.Unlock()
+		pq.release()
+		logger.WithFields(log.Fields{
+			"selector": pq.s,
+			"error":    ctx.Err(),
+		}).Debug("Get interrupted before final reply")
+		return &ZError{Msg: "Get on " + pq.s.ToString() + " interrupted before final reply", Code: 0, Cause: ctx.Err()}
+	}
+}
+
+// queryReply is a reply to a query, copied from the znet.ReplyValue
+// (which is released once the ReplyHandler returns).
+type queryReply struct {
+	kind     znet.ReplyKind
+	srcID    []byte
+	rsn      uint64
+	rname    string
+	data     []byte
+	encoding Encoding
+	tstamp   *Timestamp
+}
+
+func queryReplyOf(reply *znet.ReplyValue) *queryReply {
+	r := &queryReply{kind: reply.Kind()}
+	if r.kind != znet.ZNStorageData && r.kind != znet.ZNEvalData {
+		return r
+	}
+	info := reply.Info()
+	r.srcID, r.rsn, r.rname, r.data = reply.SrcID(), reply.RSN(), reply.RName(), reply.Data()
+	r.encoding = info.Encoding()
+	if ts := info.Tstamp(); ts != nil {
+		tsCopy := *ts
+		r.tstamp = &tsCopy
+	}
+	return r
+}
+
+// decodeReply returns the Data contained in a ZNStorageData or ZNEvalData reply,
+// or nil if it cannot be decoded. For an error replied by an eval, the Data has no
+// Value and the error as Err().
+func decodeReply(logger *log.Entry, reply *queryReply) *Data {
+	path, err := NewPath(reply.rname)
+	if err != nil {
+		logger.WithField("reply path", reply.rname).
+			Warn("Get received reply for an invalid path")
+		return nil
+	}
+	data := reply.data
+	encoding := reply.encoding
+	ts := reply.tstamp
+	// @TODO: remove this when we're sure Data always come with a Timestamp.
+	if ts == nil {
+		ts = zcore.GenerateTimestamp()
+	}
+	if reply.kind == znet.ZNStorageData {
+		logger.WithFields(log.Fields{
+			"reply path": reply.rname,
+			"len(data)":  len(data),
+			"encoding":   encoding,
+		}).Trace("Get => ZN_STORAGE_DATA")
+	} else {
+		logger.WithFields(log.Fields{
+			"reply path": reply.rname,
+			"len(data)":  len(data),
+			"encoding":   encoding,
+		}).Trace("Get => ZN_EVAL_DATA")
+	}
+
+	// only the zenoh-go storages and evals send such replies, as the query has the propExtReplies property
+	if tag, payload, ok := decodeExtReply(data); ok {
+		switch tag {
+		case extReplyValue:
+			data = payload
+		case extReplyTimestamped:
+			t, value, ok := decodeTimestamped(payload)
+			if !ok {
+				logger.WithField("reply path", reply.rname).Warn("Get : truncated Timestamp in reply")
+				return nil
+			}
+			ts, data = t, value
+		case extReplyEvalError:
+			return &Data{path, nil, ts, reply.srcID, reply.rsn, EvalSource, decodeEvalError(path, payload)}
+		default:
+			logger.WithFields(log.Fields{
+				"reply path": reply.rname,
+				"tag":        tag,
+			}).Warn("Get : unknown kind of zenoh-go reply")
+			return nil
+		}
+	}
+
+	decoder, ok := valueDecoders[encoding]
+	if !ok {
+		logger.WithFields(log.Fields{
+			"reply path": reply.rname,
+			"encoding":   encoding,
+		}).Warn("Get : no Decoder found for reply")
+		return nil
+	}
+	value, err := decoder(data)
+	if err != nil {
+		logger.WithFields(log.Fields{
+			"reply path": reply.rname,
+			"encoding":   encoding,
+			"error":      err,
+		}).Warn("Get : error decoding reply")
+		return nil
+	}
+	srcKind := StorageSource
+	if reply.kind == znet.ZNEvalData {
+		srcKind = EvalSource
+	}
+	return &Data{path, value, ts, reply.srcID, reply.rsn, srcKind, nil}
+}
+
 // Subscribe subscribes to a selection of path/value from Zenoh.
 //
 // The listener will be called for each change of a path/value matching the selection.
+// If the selector has a predicate part, the PUT and UPDATE changes with a value not
+// satisfying it are not notified to the listener.
+// If the selector has a fragment part, it's applied to the values of the PUT and UPDATE changes.
 func (w *Workspace) Subscribe(selector *Selector, listener Listener) (*SubscriptionID, error) {
+	return w.subscribe(selector, w.interceptListener(w.toAbsoluteSelector(selector), listener), nil, w.executor)
+}
+
+// SubscribeWithOptions subscribes to a selection of path/value from Zenoh, as Subscribe() does,
+// but with the subscription mode specified by opts.
+// If opts is nil, the default SubscribeOptions are used (i.e. PushMode).
+//
+// With PullMode and PeriodicPullMode, the listener is called only for the changes
+// pulled with the Pull() operation of the returned SubscriptionID.
+func (w *Workspace) SubscribeWithOptions(selector *Selector, listener Listener, opts *SubscribeOptions) (*SubscriptionID, error) {
+	return w.subscribe(selector, w.interceptListener(w.toAbsoluteSelector(selector), listener), opts, w.executor)
+}
+
+// subscribe subscribes the listener to a selection of path/value from Zenoh.
+// If exec is nil, the listener is called by the I/O subroutine.
+func (w *Workspace) subscribe(selector *Selector, listener Listener, opts *SubscribeOptions, exec *executor) (*SubscriptionID, error) {
 	s := w.toAbsoluteSelector(selector)
 	logger := logger.WithField("selector", s)
 	logger.Debug("Subscribe")
 
+	filter, err := s.Filter()
+	if err != nil {
+		return nil, &ZError{Msg: "Subscribe on " + s.ToString() + " failed", Code: 0, Cause: err}
+	}
+	fields := s.FragmentFields()
+	if opts == nil {
+		opts = new(SubscribeOptions)
+	}
+
+	dispatch := func(changes []Change) {
+		if exec != nil {
+			// the notifications for a same path are executed in order, by the same worker
+			if !exec.submit(changes[0].path.ToString(), func() { listener(changes) }) {
+				logger.WithField("notif path", changes[0].path).Debug("Subscribe : notification dropped by executor (full or shut down)")
+			}
+		} else {
+			listener(changes)
+		}
+	}
+	var merger *initialStateMerger
+	if opts.InitialState {
+		merger = newInitialStateMerger(dispatch, opts.initDone)
+	}
+
 	zListener := func(rname string, data []byte, info *znet.DataInfo) {
 		var changes = make([]Change, 1)
 		var err error
@@ -305,25 +923,87 @@ func (w *Workspace) Subscribe(selector *Selector, listener Listener) (*Subscript
 		}
 
 		changes[0].kind = info.Kind()
-		changes[0].timestamp = info.Tstamp()
+		if ts := info.Tstamp(); ts != nil {
+			// copy the Timestamp, as info is released after this call
+			tsCopy := *ts
+			changes[0].timestamp = &tsCopy
+		}
+
+		// with removeFiltered, the predicate applies to the updated value rather than to the UPDATE
+		checked := changes[0].kind == PUT || (changes[0].kind == UPDATE && !opts.removeFiltered)
+		if checked && !filter.match(encoding, changes[0].value) {
+			if !opts.removeFiltered {
+				logger.WithField("notif path", rname).Trace("Subscribe : notification filtered out by predicate")
+				return
+			}
+			// the path no longer satisfies the predicate
+			changes[0].kind, changes[0].value = REMOVE, nil
+		}
+		if fields != nil && changes[0].kind != REMOVE {
+			if v, err := projectValue(changes[0].path, encoding, changes[0].value, fields); err != nil {
+				changes[0].err = err
+			} else {
+				changes[0].value = v
+			}
+		}
 
-		if w.useSubroutine {
-			go listener(changes)
+		if merger != nil {
+			merger.notify(changes[0])
 		} else {
-			listener(changes)
+			dispatch(changes)
 		}
 	}
 
-	sub, err := w.session.DeclareSubscriber(s.Path(), znet.NewSubMode(znet.ZNPushMode), zListener)
+	sub, err := w.session.DeclareSubscriber(s.Path(), opts.subMode(), zListener)
 	if err != nil {
 		return nil, &ZError{Msg: "Subscribe on " + s.ToString() + " failed", Code: 0, Cause: err}
 	}
+	w.mu.Lock()
+	if err := w.track(); err != nil {
+		w.mu.Unlock()
+		w.session.UndeclareSubscriber(sub)
+		return nil, &ZError{Msg: "Subscribe on " + s.ToString() + " failed", Code: 0, Cause: err}
+	}
+	w.subs[sub] = opts.onClose
+	w.mu.Unlock()
+
+	if merger != nil {
+		data, evalErrs, err := w.getWithEvalErrors(context.Background(), s, nil)
+		if err != nil {
+			w.Unsubscribe(sub)
+			return nil, &ZError{Msg: "Subscribe on " + s.ToString() + " failed to get initial state", Code: 0, Cause: err}
+		}
+		if len(evalErrs) > 0 {
+			logger.WithFields(log.Fields{
+				"selector": s,
+				"error":    evalErrs,
+			}).Warn("Subscribe: evals failed while getting the initial state")
+		}
+		merger.init(data)
+	}
 	return sub, nil
 }
 
-// Unsubscribe unregisters a previous subscription
+// Unsubscribe unregisters a previous subscription made via this Workspace.
+// It does nothing if the Workspace has been closed (as Close() unregistered the subscription),
+// and returns an error if the subscription is unknown to the Workspace (e.g. already unregistered
+// or made via another Workspace).
 func (w *Workspace) Unsubscribe(subid *SubscriptionID) error {
+	w.mu.Lock()
+	onClose, ok := w.subs[subid]
+	delete(w.subs, subid)
+	closed := w.closed
+	w.mu.Unlock()
+	if !ok {
+		if closed {
+			return nil
+		}
+		return &ZError{Msg: "Unsubscribe failed: unknown subscription", Code: 0, Cause: nil}
+	}
 	err := w.session.UndeclareSubscriber(subid)
+	if onClose != nil {
+		onClose()
+	}
 	if err != nil {
 		return &ZError{Msg: "Unsubscribe failed", Code: 0, Cause: err}
 	}
@@ -331,64 +1011,29 @@ func (w *Workspace) Unsubscribe(subid *SubscriptionID) error {
 }
 
 // RegisterEval registers an "eval" function under the provided Path.
+// The value returned by eval is sent as a PUT for the Path.
 func (w *Workspace) RegisterEval(path *Path, eval Eval) error {
-	p := w.toAbsolutePath(path)
-	logger := logger.WithField("path", p)
-	logger.Debug("RegisterEval")
-
-	zQueryHandler := func(rname string, predicate string, repliesSender *znet.RepliesSender) {
-		logger.WithFields(log.Fields{
-			"rname":     rname,
-			"predicate": predicate,
-		}).Debug("Registered eval handling query")
-		s, err := NewSelector(rname + "?" + predicate)
-		if err != nil {
-			logger.WithField("selector", s).Warn("Registered eval received query for an invalid selector")
-			return
-		}
-
-		evalRoutine := func() {
-			v := eval(p, predicateToProperties(s.Properties()))
-			logger.WithFields(log.Fields{
-				"rname":     rname,
-				"predicate": predicate,
-				"value":     v,
-			}).Debug("Registered eval handling query returns")
-			replies := make([]znet.Resource, 1)
-			replies[0].RName = p.ToString()
-			replies[0].Data = v.Encode()
-			replies[0].Encoding = v.Encoding()
-			replies[0].Kind = PUT
-			repliesSender.SendReplies(replies)
-		}
-		if w.useSubroutine {
-			go evalRoutine()
-		} else {
-			evalRoutine()
-		}
-	}
+	return w.RegisterDataEval(path, func(p *Path, props Properties) ([]EvalResult, error) {
+		return []EvalResult{{Path: p, Value: eval(p, props), Kind: PUT}}, nil
+	})
+}
 
-	e, err := w.session.DeclareEval(p.ToString(), zQueryHandler)
-	if err != nil {
-		return &ZError{Msg: "RegisterEval on " + p.ToString() + " failed", Code: 0, Cause: err}
-	}
-	w.evals[*p] = e
-	return nil
+// EvalPath is the Path or the PathExpr under which an eval is registered
+// (see UnregisterEval()).
+type EvalPath interface {
+	ToString() string
 }
 
 // UnregisterEval unregisters a previously registered evaluation function.
 //
-// The path is the same that has been used for registration.
-func (w *Workspace) UnregisterEval(path *Path) error {
-	e, ok := w.evals[*path]
-	if ok {
-		delete(w.evals, *path)
-		err := w.session.UndeclareEval(e)
-		if err != nil {
-			return &ZError{Msg: "UnregisterEval on " + path.ToString() + " failed", Code: 0, Cause: err}
-		}
+// The path is the same Path or PathExpr that has been used for registration
+// (with RegisterEval(), RegisterDataEval(), RegisterPathEval() or RegisterEvalHandler()).
+func (w *Workspace) UnregisterEval(path EvalPath) error {
+	pe, err := NewPathExpr(path.ToString())
+	if err != nil {
+		return &ZError{Msg: "UnregisterEval on " + path.ToString() + " failed", Code: 0, Cause: err}
 	}
-	return nil
+	return w.unregisterEval(w.toAbsolutePathExpr(pe).ToString())
 }
 
 func (w *Workspace) toAbsolutePath(p *Path) *Path {
@@ -398,6 +1043,13 @@ func (w *Workspace) toAbsolutePath(p *Path) *Path {
 	return p
 }
 
+func (w *Workspace) toAbsolutePathExpr(pe *PathExpr) *PathExpr {
+	if pe.IsRelative() {
+		return pe.AddPrefix(w.path)
+	}
+	return pe
+}
+
 func (w *Workspace) toAbsoluteSelector(s *Selector) *Selector {
 	if s.IsRelative() {
 		return s.AddPrefix(w.path)
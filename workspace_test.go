@@ -0,0 +1,352 @@
+/*
+ * Copyright (c) 2017, 2020 ADLINK Technology Inc.
+ *
+ * This program and the accompanying materials are made available under the
+ * terms of the Eclipse Public License 2.0 which is available at
+ * http://www.eclipse.org/legal/epl-2.0, or the Apache License, Version 2.0
+ * which is available at https://www.apache.org/licenses/LICENSE-2.0.
+ *
+ * SPDX-License-Identifier: EPL-2.0 OR Apache-2.0
+ *
+ * Contributors:
+ *   ADLINK zenoh team, <zenoh@adlink-labs.tech>
+ */
+
+package zenoh
+
+import (
+	"context"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	znet "github.com/eclipse-zenoh/zenoh-go/net"
+)
+
+// testQuery is a pendingQuery collecting the Data and eval errors received in reply.
+type testQuery struct {
+	*pendingQuery
+	data     []Data
+	errs     []error
+	released int
+}
+
+func newTestQuery(t *testing.T, selector string) *testQuery {
+	s, err := NewSelector(selector)
+	if err != nil {
+		t.Fatal(err)
+	}
+	tq := new(testQuery)
+	tq.pendingQuery, err = newPendingQuery(s,
+		func(d *Data) { tq.data = append(tq.data, *d) },
+		func(err error) { tq.errs = append(tq.errs, err) })
+	if err != nil {
+		t.Fatal(err)
+	}
+	tq.release = func() { tq.released++ }
+	return tq
+}
+
+// storageReply returns a ZNStorageData reply with a string value, from the storage src.
+func storageReply(path string, value string, ts *Timestamp, src byte) *queryReply {
+	return &queryReply{kind: znet.ZNStorageData, srcID: []byte{src}, rname: path, data: []byte(value), encoding: STRING, tstamp: ts}
+}
+
+func TestQueryFinalReply(t *testing.T) {
+	q := newTestQuery(t, "/test/**")
+	q.handle(storageReply("/test/a", "a", testTimestamp(1), 1))
+	q.handle(&queryReply{kind: znet.ZNStorageFinal})
+	q.handle(&queryReply{kind: znet.ZNReplyFinal})
+	// ignored, as received after the final reply
+	q.handle(storageReply("/test/b", "b", testTimestamp(2), 1))
+
+	if err := q.wait(context.Background()); err != nil {
+		t.Fatalf("wait() failed: %v", err)
+	}
+	if len(q.data) != 1 || q.data[0].Path().ToString() != "/test/a" || q.data[0].Value().ToString() != "a" {
+		t.Errorf("received %v", q.data)
+	}
+	if q.released != 0 {
+		t.Error("finished query released")
+	}
+}
+
+func TestQueryContextDone(t *testing.T) {
+	q := newTestQuery(t, "/test/**")
+	q.handle(storageReply("/test/a", "a", testTimestamp(1), 1))
+
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Millisecond)
+	defer cancel()
+	err := q.wait(ctx)
+	if zerr, ok := err.(*ZError); !ok || zerr.Cause != context.DeadlineExceeded {
+		t.Fatalf("wait() returned %v, expected a ZError caused by the deadline", err)
+	}
+	if q.released != 1 {
+		t.Errorf("query released %d times", q.released)
+	}
+	// ignored, as received after the query has been released
+	q.handle(storageReply("/test/b", "b", testTimestamp(2), 1))
+	q.handle(&queryReply{kind: znet.ZNReplyFinal})
+	if len(q.data) != 1 || q.data[0].Path().ToString() != "/test/a" {
+		t.Errorf("received %v", q.data)
+	}
+}
+
+// testData returns a Data with a string value.
+func testData(path string, value string, ts *Timestamp) *Data {
+	p, _ := NewPath(path)
+	return &Data{path: p, value: NewStringValue(value), tstamp: ts}
+}
+
+func TestGetJSON(t *testing.T) {
+	p, _ := NewPath("/test/a")
+	jsonData := func(v testJSON, ts *Timestamp) Data {
+		jv, _ := NewJSONValue(v)
+		return Data{path: p, value: jv, tstamp: ts}
+	}
+
+	// the value with the most recent Timestamp is decoded
+	var into testJSON
+	results := []Data{jsonData(testJSON{"a", 2}, testTimestamp(2)), jsonData(testJSON{"a", 3}, testTimestamp(3)), jsonData(testJSON{"a", 1}, testTimestamp(1))}
+	if err := unmarshalLatestJSON(p, results, nil, &into); err != nil {
+		t.Fatal(err)
+	}
+	if into.Count != 3 {
+		t.Errorf("unmarshalled %v", into)
+	}
+
+	if err := unmarshalLatestJSON(p, nil, nil, &into); err == nil {
+		t.Error("no error without value")
+	}
+	evalErr := &ZError{Msg: "eval failed", Code: 0, Cause: nil}
+	err := unmarshalLatestJSON(p, nil, ErrorList{evalErr}, &into)
+	if zerr, ok := err.(*ZError); !ok || zerr.Cause.(ErrorList)[0] != evalErr {
+		t.Errorf("returned %v instead of the eval error", err)
+	}
+	if err := unmarshalLatestJSON(p, []Data{*testData("/test/a", "{}", testTimestamp(4))}, nil, &into); err == nil {
+		t.Error("no error for a string value")
+	}
+
+	// GetJSON queries the absolute path
+	root, _ := NewPath("/test")
+	w := &Workspace{path: root, mu: new(sync.Mutex)}
+	var target string
+	w.Use(func(inv *Invocation, next Handler) error {
+		target = inv.Target
+		return nil
+	})
+	rel, _ := NewPath("a")
+	if err := w.GetJSON(context.Background(), rel, &into); err == nil {
+		t.Error("no error without value")
+	}
+	if target != "/test/a" {
+		t.Errorf("queried %s", target)
+	}
+}
+
+func TestDataStreamConsolidate(t *testing.T) {
+	ds := newDataStream(context.Background(), &StreamOptions{BufferSize: 10, Consolidate: true})
+	ds.push(testData("/test/a", "a2", testTimestamp(2)))
+	// older or duplicate Data, dropped
+	ds.push(testData("/test/a", "a1", testTimestamp(1)))
+	ds.push(testData("/test/a", "a2", testTimestamp(2)))
+	ds.push(testData("/test/b", "b1", testTimestamp(1)))
+	ds.push(testData("/test/a", "a3", testTimestamp(3)))
+	s, _ := NewSelector("/test/**")
+	ds.end(s, nil, nil)
+
+	received := make([]string, 0)
+	for d := range ds.C() {
+		received = append(received, d.Value().ToString())
+	}
+	if len(received) != 3 || received[0] != "a2" || received[1] != "b1" || received[2] != "a3" {
+		t.Errorf("received %v, expected [a2 b1 a3]", received)
+	}
+	if ds.Err() != nil {
+		t.Errorf("Err() = %v", ds.Err())
+	}
+}
+
+func TestDataStreamClose(t *testing.T) {
+	ds := newDataStream(context.Background(), new(StreamOptions))
+	pushed := make(chan struct{})
+	go func() {
+		// blocked until the stream is closed, as nothing consumes the Data
+		ds.push(testData("/test/a", "a", testTimestamp(1)))
+		close(pushed)
+	}()
+	ds.Close()
+	select {
+	case <-pushed:
+	case <-time.After(5 * time.Second):
+		t.Fatal("push blocked after Close")
+	}
+	s, _ := NewSelector("/test/**")
+	ds.end(s, &ZError{Msg: "interrupted", Code: 0, Cause: context.Canceled}, nil)
+	if _, ok := <-ds.C(); ok {
+		t.Error("channel not closed")
+	}
+	if ds.Err() != nil {
+		t.Errorf("Err() = %v after Close", ds.Err())
+	}
+}
+
+func TestDataStreamErr(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	ds := newDataStream(ctx, new(StreamOptions))
+	cancel()
+	s, _ := NewSelector("/test/**")
+	ds.end(s, &ZError{Msg: "interrupted", Code: 0, Cause: context.Canceled}, ErrorList{&ZError{Msg: "eval failed"}})
+	for range ds.C() {
+	}
+	zerr, ok := ds.Err().(*ZError)
+	if !ok {
+		t.Fatalf("Err() = %v, expected a ZError", ds.Err())
+	}
+	if errs, ok := zerr.Cause.(ErrorList); !ok || len(errs) != 2 {
+		t.Errorf("Err() caused by %v, expected the query and eval errors", zerr.Cause)
+	}
+}
+
+// sourcedData returns a Data with a string value, provided by the storage src.
+func sourcedData(path string, value string, ts *Timestamp, src byte) *Data {
+	d := testData(path, value, ts)
+	d.src = []byte{src}
+	return d
+}
+
+func TestReplyConsolidation(t *testing.T) {
+	replies := []*Data{
+		sourcedData("/test/a", "a0", testTimestamp(0), 1),
+		sourcedData("/test/a", "a1", testTimestamp(1), 1),
+		sourcedData("/test/a", "a2", testTimestamp(2), 2),
+		// duplicate from another storage
+		sourcedData("/test/a", "a1", testTimestamp(1), 2),
+		sourcedData("/test/b", "b1", testTimestamp(1), 1),
+	}
+	tests := []struct {
+		selector      string
+		consolidation Consolidation
+		expected      string
+	}{
+		{"/test/**", ConsolidateAuto, "a2 b1"},
+		{"/test/**?(starttime=now()-1h)", ConsolidateAuto, "a0 a1 a2 b1"},
+		{"/test/**?(starttime=now()-1h)", ConsolidateLatest, "a2 b1"},
+		{"/test/**", ConsolidateNone, "a0 a1 a2 b1"},
+		{"/test/**", ConsolidatePerSource, "a1 a2 b1"},
+	}
+	for _, test := range tests {
+		s, _ := NewSelector(test.selector)
+		rc := newReplyCollector(s, test.consolidation)
+		for _, d := range replies {
+			rc.add(d)
+		}
+		values := make([]string, 0)
+		for _, d := range rc.results() {
+			values = append(values, d.Value().ToString())
+		}
+		sort.Strings(values)
+		if strings.Join(values, " ") != test.expected {
+			t.Errorf("consolidation %d of %s: %v, expected [%s]", test.consolidation, test.selector, values, test.expected)
+		}
+	}
+}
+
+func TestQueryDest(t *testing.T) {
+	tests := []struct {
+		dest     QueryDest
+		expected znet.QueryDest
+	}{
+		{DestBestMatch, znet.NewQueryDest(znet.ZNBestMatch)},
+		{DestComplete, znet.NewQueryDest(znet.ZNComplete)},
+		{DestAll, znet.NewQueryDest(znet.ZNAll)},
+		{DestNone, znet.NewQueryDest(znet.ZNNone)},
+	}
+	for _, test := range tests {
+		if test.dest.toZNet() != test.expected {
+			t.Errorf("QueryDest %d converted to %v, expected %v", test.dest, test.dest.toZNet(), test.expected)
+		}
+	}
+}
+
+func TestReplyProvenance(t *testing.T) {
+	q := newTestQuery(t, "/test/**")
+	q.handle(&queryReply{kind: znet.ZNStorageData, srcID: []byte{1}, rsn: 3, rname: "/test/a", data: []byte("a"),
+		encoding: STRING, tstamp: testTimestamp(1)})
+	q.handle(&queryReply{kind: znet.ZNEvalData, srcID: []byte{2}, rsn: 0, rname: "/test/b", data: []byte("b"),
+		encoding: STRING, tstamp: testTimestamp(1)})
+	q.handle(&queryReply{kind: znet.ZNStorageData, srcID: []byte{1}, rsn: 4, rname: "/test/c", data: []byte("c"),
+		encoding: STRING, tstamp: testTimestamp(1)})
+	if len(q.data) != 3 {
+		t.Fatalf("received %d Data", len(q.data))
+	}
+	a, b := q.data[0], q.data[1]
+	if a.SourceKind() != StorageSource || a.RSN() != 3 || string(a.SourceID()) != "\x01" {
+		t.Errorf("storage Data from %x (kind %d, rsn %d)", a.SourceID(), a.SourceKind(), a.RSN())
+	}
+	if b.SourceKind() != EvalSource || b.RSN() != 0 || string(b.SourceID()) != "\x02" {
+		t.Errorf("eval Data from %x (kind %d, rsn %d)", b.SourceID(), b.SourceKind(), b.RSN())
+	}
+
+	groups := GroupBySource(q.data)
+	if len(groups) != 2 || len(groups["01"]) != 2 || len(groups["02"]) != 1 {
+		t.Errorf("GroupBySource() = %v", groups)
+	}
+	if groups["01"][0].Path().ToString() != "/test/a" || groups["01"][1].Path().ToString() != "/test/c" {
+		t.Errorf("GroupBySource() changed the order of the Data: %v", groups["01"])
+	}
+}
+
+func TestWorkspaceClose(t *testing.T) {
+	z := &Zenoh{mu: new(sync.Mutex), workspaces: make(map[*Workspace]bool)}
+	root, _ := NewPath("/test")
+	w := z.WorkspaceWithExecutorOptions(root, &ExecutorOptions{Workers: 2})
+	ap, declared, undeclared := newTestAutoPublishers()
+	w.autoPub = ap.autoPub
+	w.SetAutoPublish(1, time.Hour)
+	p, _ := NewPath("/test/a")
+	w.autoPub.release(w.autoPub.publisherFor(p))
+	if *declared != 1 {
+		t.Fatalf("%d publishers declared, expected 1", *declared)
+	}
+
+	// the queued listeners are executed before Close returns
+	executed := make([]bool, 10)
+	for i := range executed {
+		i := i
+		w.executor.submit("/test/"+strconv.Itoa(i), func() {
+			time.Sleep(time.Millisecond)
+			executed[i] = true
+		})
+	}
+	if err := w.Close(); err != nil {
+		t.Fatalf("Close() failed: %v", err)
+	}
+	for i, ok := range executed {
+		if !ok {
+			t.Errorf("task %d not executed before Close() returned", i)
+		}
+	}
+	if *undeclared != 1 {
+		t.Errorf("%d publishers undeclared, expected 1", *undeclared)
+	}
+	if len(z.workspaces) != 0 {
+		t.Error("closed Workspace still tracked for Logout")
+	}
+
+	w.mu.Lock()
+	err := w.track()
+	w.mu.Unlock()
+	if err == nil {
+		t.Error("registration accepted by a closed Workspace")
+	}
+	if w.executor.submit("/test/a", func() {}) {
+		t.Error("listener queued by a closed Workspace")
+	}
+	if err := w.Close(); err != nil {
+		t.Errorf("second Close() failed: %v", err)
+	}
+}
@@ -13,10 +13,27 @@
  */
 
 // Package zenoh provides the Zenoh client API in Go.
+//
+// The evals and storages registered via a Workspace can send extended replies, carrying information
+// that zenoh-net cannot carry: the errors returned by the evals (see Workspace.RegisterDataEval()),
+// and the Timestamps of the values stored by the storages (see Workspace.RegisterStorage()).
+// They send such replies only to the queriers adding the "_zgo=1" property to the Selector
+// of their query, as the Workspace does. This property is removed from the Selector before
+// it's passed to the evals and storages.
+//
+// An extended reply has the PUT kind, and its data starts with the 4 bytes "\x00zgo" followed by a tag:
+//
+//	'e': the remaining data is the error, as a JSON object with "msg" and "code" fields.
+//	't': the remaining data is the Timestamp (its time as a big-endian uint64, then its
+//	     16 bytes clock id), followed by the value.
+//	'v': the remaining data is the value, which starts with "\x00zgo".
+//
+// The data of any other reply is the value, as for the other Zenoh clients.
 package zenoh
 
 import (
 	"encoding/hex"
+	"sync"
 
 	znet "github.com/eclipse-zenoh/zenoh-go/net"
 	log "github.com/sirupsen/logrus"
@@ -30,9 +47,12 @@ const PropPassword = "password"
 
 // Zenoh is the Zenoh client API
 type Zenoh struct {
-	session *znet.Session
-	zenohid string
-	admin   *Admin
+	session    *znet.Session
+	zenohid    string
+	admin      *Admin
+	mu         *sync.Mutex
+	workspaces map[*Workspace]bool
+	clock      *hlc
 }
 
 var logger = log.WithFields(log.Fields{" pkg": "zenoh"})
@@ -45,8 +65,23 @@ func newZenoh(s *znet.Session) (*Zenoh, error) {
 	}
 	zenohid := hex.EncodeToString(pid)
 	adminPath, _ := NewPath("/@")
-	adminWS := &Workspace{adminPath, s, make(map[Path]*znet.Eval), false}
-	return &Zenoh{s, zenohid, &Admin{adminWS, zenohid}}, nil
+	z := &Zenoh{s, zenohid, nil, new(sync.Mutex), make(map[*Workspace]bool), newHLC(pid)}
+	z.admin = &Admin{newWorkspace(z, adminPath, nil), zenohid}
+	return z, nil
+}
+
+// track registers a Workspace to be closed at Logout.
+func (z *Zenoh) track(w *Workspace) {
+	z.mu.Lock()
+	z.workspaces[w] = true
+	z.mu.Unlock()
+}
+
+// untrack unregisters a closed Workspace.
+func (z *Zenoh) untrack(w *Workspace) {
+	z.mu.Lock()
+	delete(z.workspaces, w)
+	z.mu.Unlock()
 }
 
 func getZProps(properties Properties) map[int][]byte {
@@ -81,9 +116,28 @@ func Login(locator *string, properties Properties) (*Zenoh, error) {
 }
 
 // Logout terminates the Zenoh session.
+//
+// Before, it closes all the Workspaces (see Workspace.Close()), releasing their
+// subscriptions, evals and publishers and waiting for the listeners and eval callbacks
+// already queued in their executors to be executed. Thus, Logout must not be called by
+// a listener or an eval callback executed by those executors.
 func (z *Zenoh) Logout() error {
+	z.mu.Lock()
+	workspaces := z.workspaces
+	z.workspaces = make(map[*Workspace]bool)
+	z.mu.Unlock()
+
+	errs := make(ErrorList, 0)
+	for w := range workspaces {
+		if e := w.Close(); e != nil {
+			errs = append(errs, e)
+		}
+	}
 	if e := z.session.Close(); e != nil {
-		return &ZError{Msg: "Error during logout", Code: 0, Cause: e}
+		errs = append(errs, e)
+	}
+	if len(errs) > 0 {
+		return &ZError{Msg: "Error during logout", Code: 0, Cause: errs}
 	}
 	return nil
 }
@@ -95,17 +149,37 @@ func (z *Zenoh) Logout() error {
 // executed by the I/O subroutine. This implies that no long operations or other call to Zenoh
 // shall be performed in those callbacks.
 func (z *Zenoh) Workspace(path *Path) *Workspace {
-	return &Workspace{path, z.session, make(map[Path]*znet.Eval), false}
+	return newWorkspace(z, path, nil)
 }
 
 // WorkspaceWithExecutor creates a Workspace using the provided path.
 // All relative Selector or Path used with this Workspace will be relative to this path.
 //
 // Notice that all subscription listeners and eval callbacks declared in this workspace will be
-// executed by their own subroutine. This is useful when listeners and/or callbacks need to perform
-// long operations or need to call other Zenoh operations.
+// executed by a pool of subroutines, with the default ExecutorOptions. This is useful when listeners
+// and/or callbacks need to perform long operations, or operations waiting for replies such as Get.
+// Such a Get must not wait for the replies of an eval registered via the same Workspace
+// (see ExecutorOptions.DropOnOverflow), and the Workspace must not be closed synchronously
+// by its listeners and callbacks (see Workspace.Close()).
 func (z *Zenoh) WorkspaceWithExecutor(path *Path) *Workspace {
-	return &Workspace{path, z.session, make(map[Path]*znet.Eval), true}
+	return z.WorkspaceWithExecutorOptions(path, nil)
+}
+
+// WorkspaceWithExecutorOptions creates a Workspace using the provided path,
+// as WorkspaceWithExecutor() does, but with an executor configured by opts.
+// If opts is nil, the default ExecutorOptions are used.
+//
+// The notifications for a same path are executed in order, by the same subroutine.
+func (z *Zenoh) WorkspaceWithExecutorOptions(path *Path, opts *ExecutorOptions) *Workspace {
+	if opts == nil {
+		opts = new(ExecutorOptions)
+	}
+	w := newWorkspace(z, path, newExecutor(opts))
+	// track the Workspace for its executor to be shut down at Logout
+	w.mu.Lock()
+	w.track()
+	w.mu.Unlock()
+	return w
 }
 
 // Admin returns the admin object that provides